@@ -0,0 +1,57 @@
+package analytics
+
+import "fmt"
+
+// Property types accepted in event schemas
+const (
+	String = "string"
+	Number = "number"
+	Bool   = "bool"
+)
+
+// Schema required properties of an event and their types
+type Schema map[string]string
+
+// schemas registry of accepted events, add an entry before clients send a new event
+var schemas = map[string]Schema{
+	"page_view":      {"path": String},
+	"product_viewed": {"product_id": Number},
+	"search":         {"query": String, "results": Number},
+	"signup_started": {},
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return String
+	case float64:
+		return Number
+	case bool:
+		return Bool
+	default:
+		return "unsupported"
+	}
+}
+
+// Validate check an event against its registered schema
+func Validate(name string, props map[string]interface{}) error {
+	schema, ok := schemas[name]
+	if !ok {
+		return fmt.Errorf("unknown event %q", name)
+	}
+	for key, want := range schema {
+		v, ok := props[key]
+		if !ok {
+			return fmt.Errorf("event %q is missing property %q", name, key)
+		}
+		if got := typeOf(v); got != want {
+			return fmt.Errorf("property %q of event %q must be a %s, got %s", key, name, want, got)
+		}
+	}
+	for key := range props {
+		if _, ok := schema[key]; !ok {
+			return fmt.Errorf("event %q has unexpected property %q", name, key)
+		}
+	}
+	return nil
+}
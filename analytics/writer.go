@@ -0,0 +1,67 @@
+package analytics
+
+import (
+	"app/database"
+	"app/model"
+	"expvar"
+	"log"
+	"time"
+)
+
+const (
+	queueSize     = 10000
+	batchSize     = 500
+	flushInterval = 2 * time.Second
+)
+
+var (
+	queue   = make(chan model.AnalyticsEvent, queueSize)
+	dropped = expvar.NewInt("analytics_events_dropped")
+)
+
+// Enqueue hand events to the background writer, reporting false when the queue is full
+func Enqueue(events []model.AnalyticsEvent) bool {
+	if len(queue)+len(events) > cap(queue) {
+		dropped.Add(int64(len(events)))
+		return false
+	}
+	for _, e := range events {
+		select {
+		case queue <- e:
+		default:
+			dropped.Add(1)
+		}
+	}
+	return true
+}
+
+func flush(batch []model.AnalyticsEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := database.DB.CreateInBatches(batch, batchSize).Error; err != nil {
+		dropped.Add(int64(len(batch)))
+		log.Println("failed to write analytics events:", err)
+	}
+}
+
+// Start write queued events to the database in batches
+func Start() {
+	go func() {
+		batch := make([]model.AnalyticsEvent, 0, batchSize)
+		ticker := time.NewTicker(flushInterval)
+		for {
+			select {
+			case e := <-queue:
+				batch = append(batch, e)
+				if len(batch) >= batchSize {
+					flush(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}()
+}
@@ -1,25 +1,70 @@
 package main
 
 import (
+	"app/analytics"
+	"app/config"
+	"app/currency"
 	"app/database"
+	"app/handler"
+	"app/jobs"
+	"app/middleware"
 	"app/router"
+	"app/scheduler"
+	"app/startup"
+	"flag"
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	// "github.com/gofiber/fiber/v2/middleware/cors"
 )
 
+// durationEnv duration in key, zero (no limit) when unset or invalid
+func durationEnv(key string) time.Duration {
+	d, err := time.ParseDuration(config.Config(key))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
 func main() {
+	flag.BoolVar(&database.AllowDestructive, "allow-destructive-migrations", false, "apply pending destructive migrations")
+	flag.Parse()
+
 	app := fiber.New(fiber.Config{
 		Prefork:       true,
 		CaseSensitive: true,
 		StrictRouting: true,
 		ServerHeader:  "Fiber",
 		AppName:       "App Name",
+		ErrorHandler:  middleware.ErrorHandler,
+		// keep IdleTimeout above the load balancer's idle timeout so it never reuses a connection we just closed
+		ReadTimeout:       durationEnv("HTTP_READ_TIMEOUT"),
+		WriteTimeout:      durationEnv("HTTP_WRITE_TIMEOUT"),
+		IdleTimeout:       durationEnv("HTTP_IDLE_TIMEOUT"),
+		DisableKeepalive:  config.Config("HTTP_KEEPALIVE") == "false",
+		StreamRequestBody: config.Config("HTTP_STREAM_REQUEST_BODY") == "true",
 	})
 	// app.Use(cors.New())
 
-	database.ConnectDB()
+	if err := startup.Run(); err != nil {
+		log.Fatal(err)
+	}
+	handler.StartFeedRefresher()
+	handler.StartViewCountFlusher()
+	analytics.Start()
+	scheduler.Every("purge-nonces", 10*time.Minute, middleware.PurgeNonces)
+	scheduler.Every("trending", 15*time.Minute, handler.ComputeTrending)
+	scheduler.Every("purge-revoked-tokens", time.Hour, middleware.PurgeRevokedTokens)
+	scheduler.Every("purge-storage", time.Hour, database.PurgeStorage)
+	scheduler.Every("purge-guests", 24*time.Hour, handler.PurgeGuests)
+	scheduler.Every("erase-deleted-users", time.Hour, handler.EraseDeletedUsers)
+	scheduler.Every("fail-stale-jobs", 5*time.Minute, jobs.FailStale)
+	scheduler.Every("purge-uploads", time.Hour, handler.PurgeUploads)
+	scheduler.Every("purge-otp-codes", 10*time.Minute, handler.PurgeOTPCodes)
+	scheduler.Every("purge-email-changes", time.Hour, handler.PurgeEmailChanges)
+	scheduler.Every("refresh-exchange-rates", time.Hour, currency.Refresh)
 
 	router.SetupRoutes(app)
 	log.Fatal(app.Listen(":3000"))
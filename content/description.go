@@ -0,0 +1,55 @@
+package content
+
+import (
+	"app/config"
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+)
+
+const defaultDescriptionTags = "p,br,strong,em,ul,ol,li,a,code,pre,blockquote"
+
+var (
+	policyOnce sync.Once
+	policy     *bluemonday.Policy
+)
+
+// descriptionPolicy allow only the tags in PRODUCT_HTML_TAGS, links limited to
+// http(s) and mailto URLs and marked nofollow
+func descriptionPolicy() *bluemonday.Policy {
+	policyOnce.Do(func() {
+		tags := config.Config("PRODUCT_HTML_TAGS")
+		if tags == "" {
+			tags = defaultDescriptionTags
+		}
+
+		policy = bluemonday.NewPolicy()
+		for _, tag := range strings.Split(tags, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" {
+				continue
+			}
+			policy.AllowElements(tag)
+			if tag == "a" {
+				policy.AllowAttrs("href").OnElements("a")
+				policy.AllowURLSchemes("http", "https", "mailto")
+				policy.RequireParseableURLs(true)
+				policy.RequireNoFollowOnLinks(true)
+			}
+		}
+	})
+	return policy
+}
+
+// RenderDescription render a Markdown product description to HTML reduced to the allowed tag set.
+// Raw HTML in the Markdown is dropped by the renderer and anything else unsafe by the sanitizer.
+func RenderDescription(markdown string) (string, error) {
+	var buf bytes.Buffer
+	if err := goldmark.Convert([]byte(markdown), &buf); err != nil {
+		return "", err
+	}
+	return descriptionPolicy().Sanitize(buf.String()), nil
+}
@@ -0,0 +1,189 @@
+package currency
+
+import (
+	"app/clock"
+	"app/config"
+	"app/database"
+	"app/model"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// RatesSetting settings key holding the latest exchange rates for every instance
+const RatesSetting = "exchange_rates"
+
+const ratesRefresh = time.Minute
+
+// Rates exchange rates against Base, which has rate 1
+type Rates struct {
+	Base      string             `json:"base"`
+	Rates     map[string]float64 `json:"rates"`
+	FetchedAt time.Time          `json:"fetched_at"`
+}
+
+// Supports report whether amounts can be converted to and from code
+func (r Rates) Supports(code string) bool {
+	_, ok := r.Rates[code]
+	return ok || code == r.Base
+}
+
+func (r Rates) rate(code string) float64 {
+	if code == r.Base {
+		return 1
+	}
+	return r.Rates[code]
+}
+
+// Rate units of to bought by one unit of from; false when either is unsupported
+func (r Rates) Rate(from, to string) (float64, bool) {
+	if !r.Supports(from) || !r.Supports(to) || r.rate(from) == 0 {
+		return 0, false
+	}
+	return r.rate(to) / r.rate(from), true
+}
+
+// Convert amount from one currency to another, rounded to two decimals; false when either is unsupported
+func (r Rates) Convert(amount float64, from, to string) (float64, bool) {
+	rate, ok := r.Rate(from, to)
+	return math.Round(amount*rate*100) / 100, ok
+}
+
+// Provider source of exchange rates
+type Provider interface {
+	Fetch(ctx context.Context) (Rates, error)
+}
+
+// NewProvider provider chosen by CURRENCY_PROVIDER: ecb for the European Central Bank's daily
+// reference rates, or fixed for the CURRENCY_RATES list. Unset, conversion is off and it returns nil.
+func NewProvider() Provider {
+	switch config.Config("CURRENCY_PROVIDER") {
+	case "ecb":
+		return &ECB{Client: &http.Client{Timeout: 10 * time.Second}}
+	case "fixed":
+		return Fixed(config.Config("CURRENCY_RATES"))
+	}
+	return nil
+}
+
+// Fixed rates from a list like "USD=1,EUR=0.92,GBP=0.79", the first code being the base
+type Fixed string
+
+// Fetch implements Provider
+func (f Fixed) Fetch(context.Context) (Rates, error) {
+	rates := Rates{Rates: map[string]float64{}, FetchedAt: clock.Now()}
+	for i, pair := range strings.Split(string(f), ",") {
+		code, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		rate, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil || rate <= 0 {
+			return Rates{}, fmt.Errorf("invalid CURRENCY_RATES entry %q", pair)
+		}
+		if i == 0 {
+			rates.Base = strings.ToUpper(code)
+		}
+		rates.Rates[strings.ToUpper(code)] = rate
+	}
+	return rates, nil
+}
+
+// ecbDailyURL euro foreign exchange reference rates, published each working day
+const ecbDailyURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// ECB rates published by the European Central Bank, against EUR
+type ECB struct {
+	Client *http.Client
+}
+
+// Fetch implements Provider
+func (e *ECB) Fetch(ctx context.Context) (Rates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ecbDailyURL, nil)
+	if err != nil {
+		return Rates{}, err
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return Rates{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Rates{}, fmt.Errorf("ecb returned %s", resp.Status)
+	}
+
+	var doc struct {
+		Cubes []struct {
+			Currency string  `xml:"currency,attr"`
+			Rate     float64 `xml:"rate,attr"`
+		} `xml:"Cube>Cube>Cube"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return Rates{}, err
+	}
+	if len(doc.Cubes) == 0 {
+		return Rates{}, errors.New("ecb returned no rates")
+	}
+	rates := Rates{Base: "EUR", Rates: map[string]float64{}, FetchedAt: clock.Now()}
+	for _, c := range doc.Cubes {
+		rates.Rates[c.Currency] = c.Rate
+	}
+	return rates, nil
+}
+
+var cached = struct {
+	sync.Mutex
+	rates   Rates
+	ok      bool
+	checked time.Time
+}{}
+
+// Refresh fetch rates from the configured provider and store them for every instance
+func Refresh(ctx context.Context) error {
+	provider := NewProvider()
+	if provider == nil {
+		return nil
+	}
+	rates, err := provider.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(rates)
+	if err != nil {
+		return err
+	}
+	err = database.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&model.Setting{Key: RatesSetting, Value: string(b)}).Error
+	if err != nil {
+		return err
+	}
+
+	cached.Lock()
+	cached.rates, cached.ok, cached.checked = rates, true, time.Now()
+	cached.Unlock()
+	return nil
+}
+
+// Current latest stored rates, re-read every minute; false until rates were first fetched
+func Current() (Rates, bool) {
+	cached.Lock()
+	defer cached.Unlock()
+	if time.Since(cached.checked) > ratesRefresh {
+		var s model.Setting
+		if err := database.DB.Limit(1).Find(&s, "key = ?", RatesSetting).Error; err == nil && s.Value != "" {
+			var rates Rates
+			if json.Unmarshal([]byte(s.Value), &rates) == nil {
+				cached.rates, cached.ok = rates, true
+			}
+		}
+		cached.checked = time.Now()
+	}
+	return cached.rates, cached.ok
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type actorKey struct{}
+
+// WithActor attach the ID of the user making changes, stamped into CreatedBy/UpdatedBy on write
+func WithActor(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, actorKey{}, id)
+}
+
+// ActorFrom user ID attached by WithActor
+func ActorFrom(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(actorKey{}).(uint)
+	return id, ok
+}
+
+func stampActor(create bool) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil {
+			return
+		}
+		id, ok := ActorFrom(tx.Statement.Context)
+		if !ok {
+			return
+		}
+		if create && tx.Statement.Schema.LookUpField("CreatedBy") != nil {
+			tx.Statement.SetColumn("CreatedBy", &id, true)
+		}
+		if tx.Statement.Schema.LookUpField("UpdatedBy") != nil {
+			tx.Statement.SetColumn("UpdatedBy", &id, true)
+		}
+	}
+}
+
+// registerActorCallbacks fill CreatedBy/UpdatedBy on models that have them, for
+// writes made through a session whose context carries WithActor
+func registerActorCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("app:stamp_created_by", stampActor(true)); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("app:stamp_updated_by", stampActor(false))
+}
@@ -3,37 +3,94 @@ package database
 import (
 	"app/config"
 	"app/model"
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// ConnectDB connect to db
-func ConnectDB() {
-	var err error
+func dsn() (string, error) {
 	p := config.Config("DB_PORT")
 	port, err := strconv.ParseUint(p, 10, 32)
-
 	if err != nil {
-		panic("failed to parse database port")
+		return "", fmt.Errorf("failed to parse database port: %w", err)
 	}
 
-	dsn := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=db port=%d user=%s password=%s dbname=%s sslmode=disable",
 		port,
 		config.Config("DB_USER"),
 		config.Config("DB_PASSWORD"),
 		config.Config("DB_NAME"),
-	)
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	), nil
+}
 
+// Connect open the database, retrying until it answers or ctx is done
+func Connect(ctx context.Context) error {
+	dsn, err := dsn()
 	if err != nil {
-		panic("failed to connect database")
+		return err
 	}
 
-	fmt.Println("Connection Opened to Database")
-	DB.AutoMigrate(&model.Product{}, &model.User{})
+	for {
+		DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err == nil {
+			sqlDB, dbErr := DB.DB()
+			if dbErr == nil {
+				dbErr = sqlDB.PingContext(ctx)
+			}
+			if dbErr == nil {
+				fmt.Println("Connection Opened to Database")
+				if err := registerActorCallbacks(DB); err != nil {
+					return err
+				}
+				if config.Config("APP_ENV") == "dev" {
+					if err := registerQueryCounter(DB); err != nil {
+						return err
+					}
+					return registerSeqScanCheck(DB)
+				}
+				return nil
+			}
+			err = dbErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect database: %w", err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Migrate apply the schema for every model. Replicas starting together take turns,
+// so only one runs the DDL and the others find it applied.
+func Migrate(ctx context.Context) error {
+	return WaitAdvisoryLock(ctx, "migrations", func(context.Context) error {
+		return migrate()
+	})
+}
+
+func migrate() error {
+	if err := DB.AutoMigrate(&model.Product{}, &model.User{}, &model.Event{}, &model.RequestNonce{}, &model.Setting{}, &model.AnalyticsEvent{},
+		&model.Experiment{}, &model.ExperimentVariant{}, &model.ExperimentExposure{}, &model.AuditLog{}, &model.ProductView{}, &model.TrendingProduct{}, &model.RevokedToken{}, &model.StorageEntry{}, &model.CacheTag{}, &model.IPAllowlistEntry{}, &model.Job{}, &model.Upload{}, &model.UploadPart{}, &model.OTPCode{}, &model.Identity{}, &model.EmailChange{}, &model.Category{}, &model.CategoryAttribute{}, &model.ProductTranslation{}, &model.ScheduledRun{}); err != nil {
+		return err
+	}
+	if err := RunMigrations(); err != nil {
+		return err
+	}
 	fmt.Println("Database Migrated")
+	return nil
+}
+
+// Ping check the database still answers
+func Ping(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
 }
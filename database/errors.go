@@ -0,0 +1,16 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsUniqueViolation report whether err is a unique constraint violation on index, or on any index when index is empty
+func IsUniqueViolation(err error, index string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return false
+	}
+	return index == "" || pgErr.ConstraintName == index
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"app/config"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type planNode struct {
+	NodeType string     `json:"Node Type"`
+	Relation string     `json:"Relation Name"`
+	Rows     float64    `json:"Plan Rows"`
+	Plans    []planNode `json:"Plans"`
+}
+
+func seqScans(n planNode, threshold float64, found []planNode) []planNode {
+	if n.NodeType == "Seq Scan" && n.Rows >= threshold {
+		found = append(found, n)
+	}
+	for _, child := range n.Plans {
+		found = seqScans(child, threshold, found)
+	}
+	return found
+}
+
+// registerSeqScanCheck log a warning in development when a SELECT plans a sequential scan
+// over at least SEQ_SCAN_WARN_ROWS rows (default 1000), pointing at a missing index
+func registerSeqScanCheck(db *gorm.DB) error {
+	threshold, err := strconv.ParseFloat(config.Config("SEQ_SCAN_WARN_ROWS"), 64)
+	if err != nil || threshold <= 0 {
+		threshold = 1000
+	}
+
+	return db.Callback().Query().After("gorm:query").Register("app:seq_scan_check", func(tx *gorm.DB) {
+		query := tx.Statement.SQL.String()
+		if tx.Error != nil || !strings.HasPrefix(strings.ToUpper(query), "SELECT") {
+			return
+		}
+		sqlDB, err := tx.DB()
+		if err != nil {
+			return
+		}
+
+		// run on the raw connection so the EXPLAIN itself does not go through this callback
+		var raw []byte
+		row := sqlDB.QueryRowContext(tx.Statement.Context, "EXPLAIN (FORMAT JSON) "+query, tx.Statement.Vars...)
+		if err := row.Scan(&raw); err != nil {
+			return
+		}
+		var plans []struct {
+			Plan planNode `json:"Plan"`
+		}
+		if err := json.Unmarshal(raw, &plans); err != nil || len(plans) == 0 {
+			return
+		}
+
+		for _, n := range seqScans(plans[0].Plan, threshold, nil) {
+			log.Printf("WARNING: seq scan over ~%.0f rows of %s: %s", n.Rows, n.Relation, query)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+)
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// WithAdvisoryLock run fn only if the Postgres advisory lock for name is free.
+// It reports whether fn ran; the lock is held on a dedicated connection and released afterwards.
+func WithAdvisoryLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	key := lockKey(name)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+
+	return true, fn(ctx)
+}
+
+// WaitAdvisoryLock run fn holding the Postgres advisory lock for name, waiting for other holders first.
+// The lock is held on a dedicated connection and released afterwards.
+func WaitAdvisoryLock(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := lockKey(name)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+
+	return fn(ctx)
+}
+
+// slotConns connections holding claimed slots, kept open for the life of the process
+var slotConns []*sql.Conn
+
+// ClaimSlot take the first free slot in [0, n) under name, held by a session-level
+// advisory lock until the process exits, so concurrent processes get distinct slots
+func ClaimSlot(ctx context.Context, name string, n int) (int, error) {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return 0, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < n; i++ {
+		var locked bool
+		key := lockKey(fmt.Sprintf("%s:%d", name, i))
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+			conn.Close()
+			return 0, err
+		}
+		if locked {
+			slotConns = append(slotConns, conn)
+			return i, nil
+		}
+	}
+	conn.Close()
+	return 0, fmt.Errorf("all %d %s slots are taken", n, name)
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"app/content"
+	"app/model"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AllowDestructive approve migrations that drop or rewrite data, set from the -allow-destructive-migrations flag
+var AllowDestructive bool
+
+// Migration a named schema change applied once, in order
+type Migration struct {
+	ID string
+	// Destructive marks contract steps (drops, type changes) that break app versions still running the old schema
+	Destructive bool
+	Up          func(tx *gorm.DB) error
+}
+
+type schemaMigration struct {
+	ID        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+// migrations applied after AutoMigrate, append new entries at the end
+var migrations = []Migration{
+	Expand("20240301_products_title_prefix_index", func(tx *gorm.DB) error {
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_products_title_prefix ON products (lower(title) text_pattern_ops)").Error
+	}),
+	Expand("20240308_products_title_trigram_index", func(tx *gorm.DB) error {
+		if err := tx.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+			return err
+		}
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_products_title_trgm ON products USING gin (lower(title) gin_trgm_ops)").Error
+	}),
+	Expand("20240308_filter_composite_indexes", func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"CREATE INDEX IF NOT EXISTS idx_product_views_user_created ON product_views (user_id, created_at)",
+			"CREATE INDEX IF NOT EXISTS idx_product_views_user_product_created ON product_views (user_id, product_id, created_at)",
+			"CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_created ON audit_logs (actor_id, created_at)",
+			"CREATE INDEX IF NOT EXISTS idx_analytics_events_user_created ON analytics_events (user_id, created_at)",
+			"CREATE INDEX IF NOT EXISTS idx_users_created ON users (created_at)",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}),
+	// the partial idx_users_*_active indexes from AutoMigrate replace these, so a
+	// soft-deleted account no longer blocks re-registering its username or email
+	Expand("20240315_users_drop_full_unique_indexes", func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"DROP INDEX IF EXISTS idx_users_username",
+			"DROP INDEX IF EXISTS idx_users_email",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}),
+	Expand("20240322_products_description_html_backfill", func(tx *gorm.DB) error {
+		var products []model.Product
+		return tx.Where("description_html = ''").FindInBatches(&products, 500, func(_ *gorm.DB, _ int) error {
+			for _, p := range products {
+				html, err := content.RenderDescription(p.Description)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&model.Product{}).Where("id = ?", p.ID).UpdateColumn("description_html", html).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	}),
+	// link the sign-in methods accounts had before identities existed
+	Expand("20240329_identities_backfill", func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			`INSERT INTO identities (created_at, user_id, provider, provider_user_id)
+			 SELECT now(), id, 'password', id::text FROM users WHERE deleted_at IS NULL AND password <> ''
+			 ON CONFLICT DO NOTHING`,
+			`INSERT INTO identities (created_at, user_id, provider, provider_user_id)
+			 SELECT now(), id, 'phone', phone_number FROM users WHERE deleted_at IS NULL AND phone_verified_at IS NOT NULL
+			 ON CONFLICT DO NOTHING`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}),
+	Expand("20240405_categories_path_prefix_index", func(tx *gorm.DB) error {
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_categories_path_prefix ON categories (path text_pattern_ops)").Error
+	}),
+	Expand("20240412_products_attributes_index", func(tx *gorm.DB) error {
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_products_attributes ON products USING gin (attributes jsonb_path_ops)").Error
+	}),
+	Expand("20240419_products_created_by_index", func(tx *gorm.DB) error {
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_products_created_by_created ON products (created_by, created_at)").Error
+	}),
+	// serve the admin user search's substring matches on username and email
+	Expand("20240426_users_search_trigram_indexes", func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops)",
+			"CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (lower(email) gin_trgm_ops)",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}),
+	// serve the product list filtered by category, newest first
+	Expand("20240503_products_category_created_index", func(tx *gorm.DB) error {
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_products_category_created ON products (category_id, created_at)").Error
+	}),
+}
+
+// Expand additive change safe to deploy while the previous version is still serving
+func Expand(id string, up func(tx *gorm.DB) error) Migration {
+	return Migration{ID: id, Up: up}
+}
+
+// Contract destructive change, only run once no deployed version depends on the old schema
+func Contract(id string, up func(tx *gorm.DB) error) Migration {
+	return Migration{ID: id, Destructive: true, Up: up}
+}
+
+// PendingDestructiveError destructive migrations waiting for approval
+type PendingDestructiveError struct {
+	IDs []string
+}
+
+func (e *PendingDestructiveError) Error() string {
+	return fmt.Sprintf("pending destructive migrations need -allow-destructive-migrations: %s", strings.Join(e.IDs, ", "))
+}
+
+// RunMigrations apply pending migrations in order. It stops at the first destructive
+// migration unless AllowDestructive is set, so later steps never run ahead of it.
+// Callers hold the migrations lock, as Migrate does.
+func RunMigrations() error {
+	if err := DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	var applied []schemaMigration
+	if err := DB.Find(&applied).Error; err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, m := range applied {
+		done[m.ID] = true
+	}
+
+	var blocked []string
+	for _, m := range migrations {
+		if done[m.ID] {
+			continue
+		}
+		if len(blocked) > 0 || (m.Destructive && !AllowDestructive) {
+			if m.Destructive {
+				blocked = append(blocked, m.ID)
+			}
+			continue
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", m.ID, err)
+		}
+		fmt.Println("Applied migration", m.ID)
+	}
+
+	if len(blocked) > 0 {
+		return &PendingDestructiveError{IDs: blocked}
+	}
+	return nil
+}
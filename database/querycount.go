@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+type queryCountKey struct{}
+
+// CountQueries attach a counter of the statements run through sessions using the returned context
+func CountQueries(ctx context.Context) (context.Context, *atomic.Int64) {
+	n := new(atomic.Int64)
+	return context.WithValue(ctx, queryCountKey{}, n), n
+}
+
+func countQuery(tx *gorm.DB) {
+	if tx.Statement.Context == nil {
+		return
+	}
+	if n, ok := tx.Statement.Context.Value(queryCountKey{}).(*atomic.Int64); ok {
+		n.Add(1)
+	}
+}
+
+// registerQueryCounter count every statement against the counter attached by CountQueries
+func registerQueryCounter(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("app:count_create", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("app:count_query", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("app:count_update", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("app:count_delete", countQuery); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("app:count_row", countQuery); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("app:count_raw", countQuery)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"app/clock"
+	"app/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Storage fiber.Storage in the storage_entries table, so middleware state such as
+// CSRF tokens is shared by every process instead of living in one prefork child
+type Storage struct {
+	// Prefix namespaces keys of one middleware
+	Prefix string
+}
+
+// Get value stored under key, nil when missing or expired
+func (s Storage) Get(key string) ([]byte, error) {
+	var entry model.StorageEntry
+	err := DB.Where("key = ? AND (expires_at IS NULL OR expires_at > ?)", s.Prefix+key, clock.Now()).
+		Limit(1).Find(&entry).Error
+	if err != nil || entry.Key == "" {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// Set store val under key, expiring after exp unless exp is 0
+func (s Storage) Set(key string, val []byte, exp time.Duration) error {
+	entry := model.StorageEntry{Key: s.Prefix + key, Value: val}
+	if exp > 0 {
+		t := clock.Now().Add(exp)
+		entry.ExpiresAt = &t
+	}
+	return DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error
+}
+
+// Delete remove key
+func (s Storage) Delete(key string) error {
+	return DB.Where("key = ?", s.Prefix+key).Delete(&model.StorageEntry{}).Error
+}
+
+// Reset remove every key under the prefix
+func (s Storage) Reset() error {
+	return DB.Where("key LIKE ?", s.Prefix+"%").Delete(&model.StorageEntry{}).Error
+}
+
+// Close nothing to release, the connection belongs to DB
+func (s Storage) Close() error {
+	return nil
+}
+
+// PurgeStorage delete expired storage entries
+func PurgeStorage(ctx context.Context) error {
+	return DB.WithContext(ctx).Where("expires_at < ?", clock.Now()).Delete(&model.StorageEntry{}).Error
+}
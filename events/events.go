@@ -0,0 +1,55 @@
+package events
+
+import (
+	"app/model"
+	"encoding/json"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Event types recorded by the handlers
+const (
+	UserCreated     = "user.created"
+	UserUpdated     = "user.updated"
+	UserDeleted     = "user.deleted"
+	UserAnonymized  = "user.anonymized"
+	UserSuspended   = "user.suspended"
+	UserUnsuspended = "user.unsuspended"
+	UserLoggedOut   = "user.logged_out"
+	UserRestored    = "user.restored"
+	ProductCreated  = "product.created"
+	ProductDeleted  = "product.deleted"
+)
+
+// Record append an event with a JSON snapshot of payload. Failures are logged
+// rather than returned so they never undo the change being recorded.
+func Record(db *gorm.DB, eventType, aggregateType string, aggregateID uint, actorID *uint, payload interface{}) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	event := model.Event{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		ActorID:       actorID,
+		Payload:       model.JSON(b),
+	}
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("failed to record %s event: %v", eventType, err)
+	}
+}
+
+// UserSnapshot user fields safe to keep in the event log
+func UserSnapshot(u *model.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       u.ID,
+		"username": u.Username,
+		"email":    u.Email,
+		"names":    u.Names,
+		"role":     u.Role,
+	}
+}
@@ -0,0 +1,31 @@
+package experiments
+
+import (
+	"app/model"
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+)
+
+// Assign pick the user's variant deterministically from a hash of user ID and experiment key,
+// so the same user always lands in the same variant while the weights stay unchanged.
+func Assign(e *model.Experiment, userID uint) (string, bool) {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(strconv.FormatUint(uint64(userID), 10) + ":" + e.Key))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+
+	for _, v := range e.Variants {
+		if bucket < v.Weight {
+			return v.Key, true
+		}
+		bucket -= v.Weight
+	}
+	return "", false
+}
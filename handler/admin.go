@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/database"
+	"app/events"
+	"app/middleware"
+	"app/model"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minUserSearchLength shortest q that the trigram indexes on username and email can serve
+const minUserSearchLength = 3
+
+// AdminGetUsers list users in ID order, a page at a time resuming after after_id. Filters: role, status
+// (active, suspended, invited or deleted), q matching part of the username or email, and from/to on created_at.
+func AdminGetUsers(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	query := db.Model(&model.User{}).Omit("password")
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("status") {
+	case "active":
+		query = query.Where("suspended_at IS NULL")
+	case "suspended":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "invited":
+		query = query.Where("invited_at IS NOT NULL")
+	case "deleted":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+		if len([]rune(q)) < minUserSearchLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("q must have at least %d characters", minUserSearchLength), "data": nil})
+		}
+		// matches the lower(username) and lower(email) trigram indexes
+		like := "%" + likeEscaper.Replace(q) + "%"
+		query = query.Where("(lower(username) LIKE ? OR lower(email) LIKE ?)", like, like)
+	}
+	if from, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+		query = query.Where("created_at < ?", to)
+	}
+
+	// keyset pagination walks the primary key, so late pages cost the same as the first
+	users := []model.User{}
+	err := query.Where("id > ?", c.QueryInt("after_id", 0)).Order("id").Limit(limit).Find(&users).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't list users", "errors": err.Error()})
+	}
+	cursor := c.Query("after_id", "0")
+	if len(users) > 0 {
+		cursor = strconv.FormatUint(uint64(users[len(users)-1].ID), 10)
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "All users",
+		"data":    users,
+		"meta":    fiber.Map{"links": cursorLinks(c, "after_id", cursor, len(users) == limit)},
+	})
+}
+
+// setUserColumn update one column of the user in :id, dropping it from the LoadUser cache
+func setUserColumn(c *fiber.Ctx, column string, value interface{}, eventType, action string) (*model.User, error) {
+	db := database.DB.WithContext(c.UserContext())
+	user, err := userByID(c, c.Params("id"))
+	if err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
+	}
+	if err := db.Model(user).Update(column, value).Error; err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update user", "errors": err.Error()})
+	}
+	middleware.ForgetUser(user.ID)
+
+	admin := middleware.CurrentUser(c)
+	events.Record(db, eventType, "user", user.ID, &admin.ID, events.UserSnapshot(user))
+	audit.Record(c, audit.Entry{Action: action, Success: true, ActorID: &admin.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	user.Password = ""
+	return user, nil
+}
+
+// AdminSuspendUser block a user from logging in or using existing tokens
+func AdminSuspendUser(c *fiber.Ctx) error {
+	user, err := setUserColumn(c, "suspended_at", clock.Now(), events.UserSuspended, audit.UserSuspended)
+	if user == nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "User suspended", "data": user})
+}
+
+// AdminUnsuspendUser lift a suspension
+func AdminUnsuspendUser(c *fiber.Ctx) error {
+	user, err := setUserColumn(c, "suspended_at", nil, events.UserUnsuspended, audit.UserUnsuspended)
+	if user == nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "User unsuspended", "data": user})
+}
+
+// AdminLogoutUser invalidate every token issued to the user so far
+func AdminLogoutUser(c *fiber.Ctx) error {
+	user, err := setUserColumn(c, "tokens_revoked_at", clock.Now(), events.UserLoggedOut, audit.UserLoggedOut)
+	if user == nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "User logged out everywhere", "data": nil})
+}
+
+// AdminRestoreUser undo a self-service deletion, unless the account was anonymized
+// or its username or email now belongs to another account
+func AdminRestoreUser(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	var user model.User
+	id, ok := paramID(c, "id")
+	if !ok || db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL AND password <> ''", id).First(&user).Error != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No restorable user found with ID", "data": nil})
+	}
+
+	var taken int64
+	db.Model(&model.User{}).Where("username = ? OR email = ?", user.Username, user.Email).Count(&taken)
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Username or email is in use by another account", "data": nil})
+	}
+
+	if err := db.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't restore user", "errors": err.Error()})
+	}
+
+	admin := middleware.CurrentUser(c)
+	events.Record(db, events.UserRestored, "user", user.ID, &admin.ID, events.UserSnapshot(&user))
+	audit.Record(c, audit.Entry{Action: audit.UserRestored, Success: true, ActorID: &admin.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	user.Password = ""
+	return c.JSON(fiber.Map{"status": "success", "message": "User restored", "data": user})
+}
+
+// impersonationTTL lifetime of a token issued by AdminImpersonateUser
+const impersonationTTL = 15 * time.Minute
+
+// AdminImpersonateUser issue a short-lived token acting as the user in :id, carrying
+// an impersonator claim so every request made with it is audited against the admin
+func AdminImpersonateUser(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	var user model.User
+	id, ok := paramID(c, "id")
+	if !ok || db.First(&user, "id = ?", id).Error != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
+	}
+	if user.Role == model.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Admins cannot be impersonated", "data": nil})
+	}
+
+	admin := middleware.CurrentUser(c)
+	t, err := signToken(user.ID, user.Username, impersonationTTL, jwt.MapClaims{"impersonator": admin.ID})
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	audit.Record(c, audit.Entry{Action: audit.Impersonated, Success: true, ActorID: &admin.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	return c.JSON(fiber.Map{"status": "success", "message": "Impersonation token", "data": fiber.Map{"token": t, "expires_in": int(impersonationTTL.Seconds())}})
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"app/audit"
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// normalizeCIDR accept a CIDR or a bare IP, returned in canonical CIDR form
+func normalizeCIDR(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", false
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32", true
+		}
+		return ip.String() + "/128", true
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", false
+	}
+	return network.String(), true
+}
+
+// ipAllowed report whether tokens for the user may be issued to ip
+func ipAllowed(db *gorm.DB, userID uint, ip string) (bool, error) {
+	var entries []model.IPAllowlistEntry
+	if err := db.Where("user_id = ?", userID).Find(&entries).Error; err != nil {
+		return false, err
+	}
+	if len(entries) == 0 {
+		return true, nil
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false, nil
+	}
+	for _, e := range entries {
+		if _, network, err := net.ParseCIDR(e.CIDR); err == nil && network.Contains(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func listAllowlist(c *fiber.Ctx, userID uint) error {
+	var entries []model.IPAllowlistEntry
+	if err := database.DB.WithContext(c.UserContext()).Where("user_id = ?", userID).Order("id").Find(&entries).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't list IP allowlist", "errors": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "IP allowlist", "data": entries})
+}
+
+func addAllowlistEntry(c *fiber.Ctx, userID uint) error {
+	type AllowlistInput struct {
+		CIDR string `json:"cidr"`
+		Note string `json:"note"`
+	}
+	var input AllowlistInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	cidr, ok := normalizeCIDR(input.CIDR)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "cidr must be an IP address or CIDR range", "data": nil})
+	}
+
+	entry := model.IPAllowlistEntry{UserID: userID, CIDR: cidr, Note: input.Note}
+	if err := database.DB.WithContext(c.UserContext()).Create(&entry).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't add IP allowlist entry", "errors": err.Error()})
+	}
+	actor := middleware.CurrentUser(c)
+	audit.Record(c, audit.Entry{Action: audit.IPAllowlistChanged, Success: true, ActorID: &actor.ID, TargetType: "user", TargetID: audit.Target(userID),
+		Details: map[string]interface{}{"added": cidr}})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Added IP allowlist entry", "data": entry})
+}
+
+func deleteAllowlistEntry(c *fiber.Ctx, userID uint) error {
+	var entry model.IPAllowlistEntry
+	id, ok := paramID(c, "entryId")
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No IP allowlist entry found with ID", "data": nil})
+	}
+	if err := database.DB.WithContext(c.UserContext()).Where("id = ? AND user_id = ?", id, userID).First(&entry).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No IP allowlist entry found with ID", "data": nil})
+	}
+	if err := database.DB.WithContext(c.UserContext()).Delete(&entry).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't delete IP allowlist entry", "errors": err.Error()})
+	}
+	actor := middleware.CurrentUser(c)
+	audit.Record(c, audit.Entry{Action: audit.IPAllowlistChanged, Success: true, ActorID: &actor.ID, TargetType: "user", TargetID: audit.Target(userID),
+		Details: map[string]interface{}{"removed": entry.CIDR}})
+	return c.JSON(fiber.Map{"status": "success", "message": "Deleted IP allowlist entry", "data": nil})
+}
+
+// GetMyIPAllowlist networks the caller's tokens may be issued to
+func GetMyIPAllowlist(c *fiber.Ctx) error {
+	return listAllowlist(c, middleware.CurrentUser(c).ID)
+}
+
+// AddMyIPAllowlistEntry restrict the caller's token issuance to one more network
+func AddMyIPAllowlistEntry(c *fiber.Ctx) error {
+	return addAllowlistEntry(c, middleware.CurrentUser(c).ID)
+}
+
+// DeleteMyIPAllowlistEntry remove a network from the caller's allowlist
+func DeleteMyIPAllowlistEntry(c *fiber.Ctx) error {
+	return deleteAllowlistEntry(c, middleware.CurrentUser(c).ID)
+}
+
+// adminAllowlistUser ID of the user in :id, writing the 404 when it does not exist
+func adminAllowlistUser(c *fiber.Ctx) (uint, error) {
+	user, err := userByID(c, c.Params("id"))
+	if err != nil {
+		return 0, c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
+	}
+	return user.ID, nil
+}
+
+// AdminGetIPAllowlist networks the user's tokens may be issued to
+func AdminGetIPAllowlist(c *fiber.Ctx) error {
+	id, err := adminAllowlistUser(c)
+	if id == 0 {
+		return err
+	}
+	return listAllowlist(c, id)
+}
+
+// AdminAddIPAllowlistEntry restrict a user's token issuance, typically a service account's
+func AdminAddIPAllowlistEntry(c *fiber.Ctx) error {
+	id, err := adminAllowlistUser(c)
+	if id == 0 {
+		return err
+	}
+	return addAllowlistEntry(c, id)
+}
+
+// AdminDeleteIPAllowlistEntry remove a network from a user's allowlist
+func AdminDeleteIPAllowlistEntry(c *fiber.Ctx) error {
+	id, err := adminAllowlistUser(c)
+	if id == 0 {
+		return err
+	}
+	return deleteAllowlistEntry(c, id)
+}
+
+// ipNotAllowed 403 for token requests from outside the user's allowlist
+func ipNotAllowed(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Tokens for this account cannot be issued to your IP address", "data": nil})
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"app/analytics"
+	"app/middleware"
+	"app/model"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxAnalyticsBatch = 100
+
+// CollectAnalyticsEvents accept a batch of client events from a user who consented to analytics
+func CollectAnalyticsEvents(c *fiber.Ctx) error {
+	type EventInput struct {
+		Name       string                 `json:"name"`
+		Properties map[string]interface{} `json:"properties"`
+		Timestamp  time.Time              `json:"timestamp"`
+	}
+	type BatchInput struct {
+		Events []EventInput `json:"events"`
+	}
+
+	user := middleware.CurrentUser(c)
+	if !user.AnalyticsConsent {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Analytics consent not given", "data": nil})
+	}
+
+	var input BatchInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	if len(input.Events) == 0 || len(input.Events) > maxAnalyticsBatch {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Send between 1 and 100 events", "data": nil})
+	}
+
+	events := make([]model.AnalyticsEvent, 0, len(input.Events))
+	var errs []string
+	for _, e := range input.Events {
+		if err := analytics.Validate(e.Name, e.Properties); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		props, _ := json.Marshal(e.Properties)
+		occurred := e.Timestamp
+		if occurred.IsZero() || occurred.After(time.Now()) {
+			occurred = time.Now()
+		}
+		events = append(events, model.AnalyticsEvent{
+			UserID:     user.ID,
+			Name:       e.Name,
+			Properties: model.JSON(props),
+			OccurredAt: occurred,
+		})
+	}
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid events", "errors": errs})
+	}
+
+	if !analytics.Enqueue(events) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "message": "Analytics queue is full, retry later", "data": nil})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "success", "message": "Events accepted", "data": fiber.Map{"accepted": len(events)}})
+}
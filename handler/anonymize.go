@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/config"
+	"app/database"
+	"app/events"
+	"app/middleware"
+	"app/model"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// anonymizedEmailDomain suffix of the email hashes anonymized accounts keep
+const anonymizedEmailDomain = "@anonymized.invalid"
+
+// defaultErasureRetention how long a deleted account can be restored before it is anonymized
+const defaultErasureRetention = 30 * 24 * time.Hour
+
+// personalTables rows tied to a user that are deleted outright on anonymization
+var personalTables = []interface{}{
+	&model.Identity{}, &model.OTPCode{}, &model.EmailChange{}, &model.IPAllowlistEntry{},
+	&model.ProductView{}, &model.AnalyticsEvent{}, &model.Job{},
+}
+
+// disposeProducts delete the user's products with ERASURE_PRODUCTS=delete, otherwise hand them
+// to the user ERASURE_PRODUCTS_OWNER, or to no one when it is unset
+func disposeProducts(tx *gorm.DB, userID uint) error {
+	if config.Config("ERASURE_PRODUCTS") == "delete" {
+		return tx.Where("created_by = ?", userID).Delete(&model.Product{}).Error
+	}
+	var owner *uint
+	if id, err := strconv.ParseUint(config.Config("ERASURE_PRODUCTS_OWNER"), 10, 64); err == nil {
+		n := uint(id)
+		owner = &n
+	}
+	for _, column := range []string{"created_by", "updated_by"} {
+		if err := tx.Unscoped().Model(&model.Product{}).Where(column+" = ?", userID).UpdateColumn(column, owner).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymizeUser scrub the user's PII, delete the rows tied to them, deal with their products and
+// redact their event history in one transaction. The row itself stays (soft-deleted) so anything
+// referencing it keeps a valid key; tokens issued to it stop working.
+func anonymizeUser(db *gorm.DB, user *model.User, actorID *uint) error {
+	sum := sha256.Sum256([]byte(strings.ToLower(user.Email)))
+	// taken before the scrub below overwrites them on user
+	identities := []string{strings.ToLower(user.Email), strings.ToLower(user.Username)}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(user).Updates(map[string]interface{}{
+			"username":          fmt.Sprintf("deleted-%d", user.ID),
+			"email":             hex.EncodeToString(sum[:]) + anonymizedEmailDomain,
+			"names":             "",
+			"password":          "",
+			"phone_number":      nil,
+			"phone_verified_at": nil,
+			"tokens_revoked_at": clock.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, table := range personalTables {
+			if err := tx.Where("user_id = ?", user.ID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if err := deleteUploads(tx, "user_id = ?", user.ID); err != nil {
+			return err
+		}
+		if err := disposeProducts(tx, user.ID); err != nil {
+			return err
+		}
+
+		err = tx.Model(&model.Event{}).
+			Where("aggregate_type = ? AND aggregate_id = ?", "user", user.ID).
+			Update("payload", model.JSON(fmt.Sprintf(`{"id":%d,"redacted":true}`, user.ID))).Error
+		if err != nil {
+			return err
+		}
+
+		// audit entries stay as a record of what happened, minus who did it from where; failed logins
+		// that only name the user by the identity they typed are matched on it
+		err = tx.Model(&model.AuditLog{}).
+			Where("actor_id = ? OR (target_type = ? AND target_id = ?)", user.ID, "user", user.ID).
+			Or("actor_id IS NULL AND action = ? AND lower(details->>'identity') IN ?", audit.LoginFailed, identities).
+			Updates(map[string]interface{}{"ip": "", "user_agent": "", "details": model.JSON(`{"redacted":true}`)}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		events.Record(tx, events.UserAnonymized, "user", user.ID, actorID, map[string]interface{}{"id": user.ID})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	middleware.ForgetUser(user.ID)
+	middleware.InvalidateCache("products")
+	return nil
+}
+
+func erasureRetention() time.Duration {
+	retention, err := time.ParseDuration(config.Config("ERASURE_RETENTION"))
+	if err != nil || retention < 0 {
+		return defaultErasureRetention
+	}
+	return retention
+}
+
+// EraseDeletedUsers anonymize accounts deleted longer ago than ERASURE_RETENTION, once they can no longer be restored
+func EraseDeletedUsers(ctx context.Context) error {
+	db := database.DB.WithContext(ctx)
+	var users []model.User
+	err := db.Unscoped().
+		Where("deleted_at < ? AND email NOT LIKE ?", clock.Now().Add(-erasureRetention()), "%"+anonymizedEmailDomain).
+		Order("deleted_at").Limit(500).Find(&users).Error
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if err := anonymizeUser(db, &users[i], nil); err != nil {
+			return fmt.Errorf("anonymize user %d: %w", users[i].ID, err)
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("erased %d deleted users", len(users))
+	}
+	return nil
+}
+
+// AnonymizeUser erase the caller's own personal data, confirmed with their password
+func AnonymizeUser(c *fiber.Ctx) error {
+	type PasswordInput struct {
+		Password string `json:"password"`
+	}
+	var pi PasswordInput
+	if ok, err := parseStrict(c, &pi); !ok {
+		return err
+	}
+	id := c.Params("id")
+	if !validToken(c, id) {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Invalid token id", "data": nil})
+	}
+
+	user := middleware.CurrentUser(c)
+	if !CheckPasswordHash(pi.Password, user.Password) {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Not valid user", "data": nil})
+	}
+
+	if err := anonymizeUser(database.DB.WithContext(c.UserContext()), user, &user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't anonymize user", "errors": err.Error()})
+	}
+	// the request's IP and user agent are the erased user's, so they're left out like those just redacted
+	origin := audit.Origin{RequestID: audit.From(c).RequestID}
+	audit.RecordFrom(origin, audit.Entry{Action: audit.UserAnonymized, Success: true, ActorID: &user.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	return c.JSON(fiber.Map{"status": "success", "message": "User successfully anonymized", "data": nil})
+}
+
+// AdminAnonymizeUser erase any user's personal data
+func AdminAnonymizeUser(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	var user model.User
+	id, ok := paramID(c, "id")
+	if !ok || db.First(&user, "id = ?", id).Error != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
+	}
+
+	admin := middleware.CurrentUser(c)
+	if err := anonymizeUser(db, &user, &admin.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't anonymize user", "errors": err.Error()})
+	}
+	audit.Record(c, audit.Entry{Action: audit.UserAnonymized, Success: true, ActorID: &admin.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	return c.JSON(fiber.Map{"status": "success", "message": "User successfully anonymized", "data": nil})
+}
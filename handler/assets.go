@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var assetHashes = map[string]string{}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// LoadAssetManifest compute content hashes for every file in the static directory
+func LoadAssetManifest(dir string) error {
+	hashes := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// skip the compressed copies fiber caches next to the originals
+		if strings.HasSuffix(path, ".fiber.gz") || strings.HasSuffix(path, ".fiber.br") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		hashes["/"+filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	assetHashes = hashes
+	return nil
+}
+
+// AssetCacheHeaders mark content-hashed asset requests as immutable
+func AssetCacheHeaders(c *fiber.Ctx) error {
+	if v := c.Query("v"); v != "" && v == assetHashes[c.Path()] {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	} else {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
+	return nil
+}
+
+// AssetManifest list versioned URLs of the static assets
+func AssetManifest(c *fiber.Ctx) error {
+	manifest := make(map[string]string, len(assetHashes))
+	for path, sum := range assetHashes {
+		manifest[path] = path + "?v=" + sum
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Asset manifest", "data": manifest})
+}
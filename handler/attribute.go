@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"app/database"
+	"app/model"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// attributeFilterPrefix query parameter prefix filtering products by attribute, as in ?attr.size=M
+const attributeFilterPrefix = "attr."
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+var attributeTypes = map[string]bool{
+	model.AttributeString:  true,
+	model.AttributeNumber:  true,
+	model.AttributeBoolean: true,
+	model.AttributeEnum:    true,
+}
+
+// categoryAttributes schema of products in cat, by key, including attributes inherited from its
+// ancestors. A subcategory's attribute replaces an ancestor's with the same key.
+func categoryAttributes(db *gorm.DB, cat *model.Category) (map[string]model.CategoryAttribute, error) {
+	var attrs []model.CategoryAttribute
+	err := db.Joins("JOIN categories ON categories.id = category_attributes.category_id").
+		Where("category_attributes.category_id IN ?", categoryLineage(cat)).
+		Order("length(categories.path)").
+		Find(&attrs).Error
+	if err != nil {
+		return nil, err
+	}
+	schema := make(map[string]model.CategoryAttribute, len(attrs))
+	for _, a := range attrs {
+		schema[a.Key] = a
+	}
+	return schema, nil
+}
+
+func enumOptions(a model.CategoryAttribute) []string {
+	var options []string
+	json.Unmarshal(a.Options, &options)
+	return options
+}
+
+func checkAttributeValue(a model.CategoryAttribute, v interface{}) string {
+	switch a.Type {
+	case model.AttributeString:
+		if _, ok := v.(string); !ok {
+			return "must be a string"
+		}
+	case model.AttributeNumber:
+		if _, ok := v.(float64); !ok {
+			return "must be a number"
+		}
+	case model.AttributeBoolean:
+		if _, ok := v.(bool); !ok {
+			return "must be true or false"
+		}
+	case model.AttributeEnum:
+		options := enumOptions(a)
+		s, _ := v.(string)
+		for _, o := range options {
+			if s == o {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	}
+	return ""
+}
+
+// checkAttributes validate a product's attributes against its category's schema, returning the
+// document to store or the problems by key
+func checkAttributes(schema map[string]model.CategoryAttribute, raw model.JSON) (model.JSON, map[string]string) {
+	values := map[string]interface{}{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, map[string]string{"attributes": "must be an object"}
+		}
+	}
+
+	errs := map[string]string{}
+	for key, v := range values {
+		a, ok := schema[key]
+		if !ok {
+			errs[key] = "is not an attribute of this category"
+		} else if msg := checkAttributeValue(a, v); msg != "" {
+			errs[key] = msg
+		}
+	}
+	for key, a := range schema {
+		if _, ok := values[key]; a.Required && !ok {
+			errs[key] = "is required"
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, map[string]string{"attributes": err.Error()}
+	}
+	return model.JSON(b), nil
+}
+
+// typedAttributeValue query parameter value as the JSON type of an attribute, false when it doesn't parse
+func typedAttributeValue(typ, s string) (interface{}, bool) {
+	switch typ {
+	case model.AttributeNumber:
+		n, err := strconv.ParseFloat(s, 64)
+		return n, err == nil
+	case model.AttributeBoolean:
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	}
+	return s, true
+}
+
+// filterByAttributes narrow query to products matching every attr.<key> parameter. Values are read
+// as the type the key has in the category schemas; an unknown key is returned as bad.
+func filterByAttributes(c *fiber.Ctx, db, query *gorm.DB) (filtered *gorm.DB, bad string) {
+	filters := map[string]string{}
+	c.Context().QueryArgs().VisitAll(func(k, v []byte) {
+		if key := string(k); strings.HasPrefix(key, attributeFilterPrefix) {
+			filters[strings.TrimPrefix(key, attributeFilterPrefix)] = string(v)
+		}
+	})
+
+	for key, value := range filters {
+		var types []string
+		db.Model(&model.CategoryAttribute{}).Where("key = ?", key).Distinct("type").Pluck("type", &types)
+		if len(types) == 0 {
+			return nil, key
+		}
+		cond := db.Where("false")
+		for _, typ := range types {
+			if v, ok := typedAttributeValue(typ, value); ok {
+				doc, _ := json.Marshal(map[string]interface{}{key: v})
+				cond = cond.Or("attributes @> ?", string(doc))
+			}
+		}
+		query = query.Where(cond)
+	}
+	return query, ""
+}
+
+// GetCategoryAttributes attributes products in a category carry, including inherited ones
+func GetCategoryAttributes(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	cat, err := categoryByID(db, c.Params("id"))
+	if err != nil {
+		return categoryNotFound(c)
+	}
+	schema, err := categoryAttributes(db, cat)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load attributes", "errors": err.Error()})
+	}
+	attrs := make([]model.CategoryAttribute, 0, len(schema))
+	for _, a := range schema {
+		attrs = append(attrs, a)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return c.JSON(fiber.Map{"status": "success", "message": "Category attributes", "data": attrs})
+}
+
+// CreateCategoryAttribute define an attribute for products in a category and its subcategories
+func CreateCategoryAttribute(c *fiber.Ctx) error {
+	type AttributeInput struct {
+		Key      string   `json:"key"`
+		Type     string   `json:"type"`
+		Options  []string `json:"options"`
+		Required bool     `json:"required"`
+	}
+	var input AttributeInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	errs := map[string]string{}
+	if !attributeKeyPattern.MatchString(input.Key) {
+		errs["key"] = "must be lowercase letters, digits and underscores, starting with a letter"
+	}
+	if !attributeTypes[input.Type] {
+		errs["type"] = "must be string, number, boolean or enum"
+	}
+	if input.Type == model.AttributeEnum && len(input.Options) == 0 {
+		errs["options"] = "are required for an enum"
+	} else if input.Type != model.AttributeEnum && len(input.Options) > 0 {
+		errs["options"] = "are only allowed for an enum"
+	}
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	cat, err := categoryByID(db, c.Params("id"))
+	if err != nil {
+		return categoryNotFound(c)
+	}
+	attr := model.CategoryAttribute{CategoryID: cat.ID, Key: input.Key, Type: input.Type, Required: input.Required}
+	if len(input.Options) > 0 {
+		b, _ := json.Marshal(input.Options)
+		attr.Options = model.JSON(b)
+	}
+	err = db.Create(&attr).Error
+	if database.IsUniqueViolation(err, "idx_category_attributes_key") {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "The category already has an attribute with this key", "data": nil})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create attribute", "errors": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Created attribute", "data": attr})
+}
+
+// DeleteCategoryAttribute remove an attribute from a category's schema. Values already on products are kept.
+func DeleteCategoryAttribute(c *fiber.Ctx) error {
+	catID, okCat := paramID(c, "id")
+	id, ok := paramID(c, "attributeId")
+	if !okCat || !ok {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No attribute found with ID", "data": nil})
+	}
+	db := database.DB.WithContext(c.UserContext())
+	res := db.Where("id = ? AND category_id = ?", id, catID).Delete(&model.CategoryAttribute{})
+	if res.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't delete attribute", "errors": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No attribute found with ID", "data": nil})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Attribute deleted", "data": nil})
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"app/database"
+	"app/model"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// paginate read page and per_page query params, per_page capped at 100
+func paginate(c *fiber.Ctx) (page, perPage int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	perPage = c.QueryInt("per_page", 20)
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	return page, perPage
+}
+
+// GetAuditLogs query the audit log, newest first, filtered by action, actor, target, success and time range
+func GetAuditLogs(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	query := db.Model(&model.AuditLog{})
+
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if id := c.QueryInt("actor_id", 0); id > 0 {
+		query = query.Where("actor_id = ?", id)
+	}
+	if t := c.Query("target_type"); t != "" {
+		query = query.Where("target_type = ?", t)
+	}
+	if id := c.QueryInt("target_id", 0); id > 0 {
+		query = query.Where("target_id = ?", id)
+	}
+	if s := c.Query("success"); s != "" {
+		query = query.Where("success = ?", c.QueryBool("success"))
+	}
+	if from, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+		query = query.Where("created_at < ?", to)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't query audit logs", "errors": err.Error()})
+	}
+
+	page, perPage := paginate(c)
+	var logs []model.AuditLog
+	if err := query.Order("id desc").Offset((page - 1) * perPage).Limit(perPage).Find(&logs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't query audit logs", "errors": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Audit logs",
+		"data":    logs,
+		"meta": fiber.Map{
+			"page":     page,
+			"per_page": perPage,
+			"total":    total,
+			"links":    pageLinks(c, page, perPage, total),
+		},
+	})
+}
@@ -1,15 +1,20 @@
 package handler
 
 import (
+	"app/audit"
+	"app/clock"
 	"app/config"
 	"app/database"
+	"app/middleware"
 	"app/model"
+	"app/random"
 	"errors"
-	"log"
+	"fmt"
 	"net/mail"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -19,12 +24,10 @@ import (
 // CheckPasswordHash compare password with hash
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	log.Println(hash, "haaaash")
 	return err == nil
 }
 
-func getUserByEmail(e string) (*model.User, error) {
-	db := database.DB
+func getUserByEmail(db *gorm.DB, e string) (*model.User, error) {
 	var user model.User
 	if err := db.Where(&model.User{Email: e}).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -35,8 +38,7 @@ func getUserByEmail(e string) (*model.User, error) {
 	return &user, nil
 }
 
-func getUserByUsername(u string) (*model.User, error) {
-	db := database.DB
+func getUserByUsername(db *gorm.DB, u string) (*model.User, error) {
 	var user model.User
 	if err := db.Where(&model.User{Username: u}).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -47,6 +49,75 @@ func getUserByUsername(u string) (*model.User, error) {
 	return &user, nil
 }
 
+// newTokenID random jti so a single token can be revoked. A jti already on the
+// denylist is drawn again, or the new token would be born revoked.
+func newTokenID() (string, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		jti, err := random.Hex(16)
+		if err != nil {
+			return "", err
+		}
+		var revoked int64
+		if err := database.DB.Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&revoked).Error; err != nil {
+			return "", err
+		}
+		if revoked == 0 {
+			return jti, nil
+		}
+	}
+	return "", errors.New("couldn't draw an unused token ID")
+}
+
+// tokenTTL lifetime of an access token
+const tokenTTL = 72 * time.Hour
+
+// rememberMeTTL lifetime of a token from a login with remember_me
+const rememberMeTTL = 30 * 24 * time.Hour
+
+// signToken sign an access token for the user valid for ttl, with extra claims added
+func signToken(id uint, username string, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.New(jwt.SigningMethodHS256)
+
+	claims := token.Claims.(jwt.MapClaims)
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["jti"] = jti
+	claims["username"] = username
+	claims["user_id"] = id
+	now := clock.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	return token.SignedString([]byte(config.Config("SECRET")))
+}
+
+// generateToken sign an access token for the user
+func generateToken(id uint, username string) (string, error) {
+	return signToken(id, username, tokenTTL, nil)
+}
+
+// deliverToken set t, valid for ttl, as an httpOnly cookie in cookie auth mode, returning what the body should carry
+func deliverToken(c *fiber.Ctx, t string, ttl time.Duration) string {
+	if !middleware.CookieAuth() {
+		return t
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     middleware.AccessTokenCookie,
+		Value:    t,
+		Path:     "/",
+		Expires:  clock.Now().Add(ttl),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+	return ""
+}
+
 func valid(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
@@ -55,8 +126,9 @@ func valid(email string) bool {
 // Login get user and password
 func Login(c *fiber.Ctx) error {
 	type LoginInput struct {
-		Identity string `json:"identity"`
-		Password string `json:"password"`
+		Identity   string `json:"email_or_username"`
+		Password   string `json:"password"`
+		RememberMe bool   `json:"remember_me"`
 	}
 	type UserData struct {
 		ID       uint   `json:"id"`
@@ -67,24 +139,26 @@ func Login(c *fiber.Ctx) error {
 	input := new(LoginInput)
 	var ud UserData
 
-	if err := c.BodyParser(input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Error on login request", "errors": err.Error()})
+	if ok, err := parseStrict(c, input); !ok {
+		return err
 	}
 
+	db := database.DB.WithContext(c.UserContext())
 	identity := input.Identity
 	pass := input.Password
 	userModel, err := new(model.User), *new(error)
 
 	if valid(identity) {
-		userModel, err = getUserByEmail(identity)
+		userModel, err = getUserByEmail(db, identity)
 	} else {
-		userModel, err = getUserByUsername(identity)
+		userModel, err = getUserByUsername(db, identity)
 	}
-	
+
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": err})
 	} else if userModel == nil {
 		CheckPasswordHash(pass, "")
+		audit.Record(c, audit.Entry{Action: audit.LoginFailed, Details: map[string]interface{}{"identity": identity, "reason": "unknown identity"}})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid identity or password", "data": err})
 	} else {
 		ud = UserData{
@@ -96,20 +170,162 @@ func Login(c *fiber.Ctx) error {
 	}
 
 	if !CheckPasswordHash(pass, ud.Password) {
+		audit.Record(c, audit.Entry{Action: audit.LoginFailed, ActorID: &ud.ID, Details: map[string]interface{}{"reason": "wrong password"}})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "message": "Invalid identity or password", "data": nil})
 	}
+	if needsRehash(ud.Password) {
+		if hash, err := hashPassword(pass); err == nil {
+			db.Model(userModel).UpdateColumn("password", hash)
+		}
+	}
+	return startSession(c, userModel, input.RememberMe, "password")
+}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = ud.Username
-	claims["user_id"] = ud.ID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+// startSession issue a login token to a user who just proved who they are with method,
+// refusing suspended users and addresses outside the user's IP allowlist
+func startSession(c *fiber.Ctx, user *model.User, rememberMe bool, method string) error {
+	if user.SuspendedAt != nil {
+		audit.Record(c, audit.Entry{Action: audit.LoginFailed, ActorID: &user.ID, Details: map[string]interface{}{"reason": "suspended", "method": method}})
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Account suspended", "data": nil})
+	}
+	if allowed, err := ipAllowed(database.DB.WithContext(c.UserContext()), user.ID, c.IP()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+	} else if !allowed {
+		audit.Record(c, audit.Entry{Action: audit.LoginFailed, ActorID: &user.ID, Details: map[string]interface{}{"reason": "ip not allowed", "method": method}})
+		return ipNotAllowed(c)
+	}
 
-	t, err := token.SignedString([]byte(config.Config("SECRET")))
+	ttl := tokenTTL
+	if rememberMe {
+		ttl = rememberMeTTL
+	}
+	t, err := signToken(user.ID, user.Username, ttl, jwt.MapClaims{"auth_time": clock.Now().Unix()})
 	if err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	audit.Record(c, audit.Entry{Action: audit.LoginSucceeded, Success: true, ActorID: &user.ID, Details: map[string]interface{}{"remember_me": rememberMe, "method": method}})
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Success login", "data": deliverToken(c, t, ttl)})
+}
+
+// Register sign up a new user, returning a token too when REGISTER_ISSUES_TOKEN=true
+func Register(c *fiber.Ctx) error {
+	type NewUser struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Token    string `json:"token,omitempty"`
+	}
 
-	return c.JSON(fiber.Map{"status": "success", "message": "Success login", "data": t})
+	user, err := registerUser(c)
+	if user == nil {
+		return err
+	}
+
+	data := NewUser{
+		Username: user.Username,
+		Email:    user.Email,
+	}
+	if config.Config("REGISTER_ISSUES_TOKEN") == "true" {
+		t, err := generateToken(user.ID, user.Username)
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		data.Token = deliverToken(c, t, tokenTTL)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Registered user", "data": data})
+}
+
+// Logout revoke the access token used for this request
+func Logout(c *fiber.Ctx) error {
+	auth, err := middleware.Claims(c)
+	if err != nil || auth.TokenID == "" || auth.ExpiresAt.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Token cannot be revoked, log out everywhere instead", "data": nil})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	revoked := model.RevokedToken{JTI: auth.TokenID, ExpiresAt: auth.ExpiresAt}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't log out", "errors": err.Error()})
+	}
+
+	user := middleware.CurrentUser(c)
+	audit.Record(c, audit.Entry{Action: audit.Logout, Success: true, ActorID: &user.ID})
+	if middleware.CookieAuth() {
+		c.ClearCookie(middleware.AccessTokenCookie)
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Logged out", "data": nil})
+}
+
+// LogoutAll revoke every access token issued to the caller so far
+func LogoutAll(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+	if err := db.Model(user).Update("tokens_revoked_at", clock.Now()).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't log out", "errors": err.Error()})
+	}
+	middleware.ForgetUser(user.ID)
+
+	audit.Record(c, audit.Entry{Action: audit.LogoutAll, Success: true, ActorID: &user.ID})
+	if middleware.CookieAuth() {
+		c.ClearCookie(middleware.AccessTokenCookie)
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Logged out everywhere", "data": nil})
+}
+
+const (
+	// defaultScopedTokenTTL lifetime of a scoped token issued without expires_in
+	defaultScopedTokenTTL = 30 * 24 * time.Hour
+	// maxScopedTokenTTL longest lifetime a scoped token can be issued with
+	maxScopedTokenTTL = 90 * 24 * time.Hour
+)
+
+// IssueScopedToken issue the caller a token limited to the requested scopes, for
+// integrations that should not hold the caller's full access
+func IssueScopedToken(c *fiber.Ctx) error {
+	type ScopedTokenInput struct {
+		Scopes    []string `json:"scopes"`
+		ExpiresIn *int     `json:"expires_in"`
+	}
+	var input ScopedTokenInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+
+	known := map[string]bool{}
+	for _, s := range middleware.Scopes {
+		known[s] = true
+	}
+	if len(input.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "At least one scope is required", "errors": middleware.Scopes})
+	}
+	scopes := make([]interface{}, 0, len(input.Scopes))
+	for _, s := range input.Scopes {
+		if !known[s] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Unknown scope " + s, "errors": middleware.Scopes})
+		}
+		scopes = append(scopes, s)
+	}
+
+	ttl := defaultScopedTokenTTL
+	if input.ExpiresIn != nil {
+		max := int(maxScopedTokenTTL.Seconds())
+		if *input.ExpiresIn < 1 || *input.ExpiresIn > max {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("expires_in must be between 1 and %d seconds", max), "data": nil})
+		}
+		ttl = time.Duration(*input.ExpiresIn) * time.Second
+	}
+
+	user := middleware.CurrentUser(c)
+	if allowed, err := ipAllowed(database.DB.WithContext(c.UserContext()), user.ID, c.IP()); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if !allowed {
+		return ipNotAllowed(c)
+	}
+	t, err := signToken(user.ID, user.Username, ttl, jwt.MapClaims{"scopes": scopes})
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	audit.Record(c, audit.Entry{Action: audit.TokenIssued, Success: true, ActorID: &user.ID, Details: map[string]interface{}{"scopes": input.Scopes, "expires_in": int(ttl.Seconds())}})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Issued scoped token", "data": fiber.Map{"token": t, "scopes": input.Scopes, "expires_in": int(ttl.Seconds())}})
 }
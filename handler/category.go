@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"app/validation"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxCategoryNameLength = 100
+
+var errCategoryCycle = errors.New("a category can't move under itself or its descendants")
+
+// categoryPath materialized path of category id placed under parent, nil for a root
+func categoryPath(parent *model.Category, id uint) string {
+	prefix := ""
+	if parent != nil {
+		prefix = parent.Path
+	}
+	return prefix + strconv.FormatUint(uint64(id), 10) + "/"
+}
+
+// categoryLineage IDs of the category's ancestors from the root, followed by its own
+func categoryLineage(cat *model.Category) []string {
+	return strings.Split(strings.TrimSuffix(cat.Path, "/"), "/")
+}
+
+// subtreeIDs subquery selecting the IDs of the category at path and everything below it
+func subtreeIDs(db *gorm.DB, path string) *gorm.DB {
+	return db.Model(&model.Category{}).Select("id").Where("path LIKE ?", path+"%")
+}
+
+func sortCategories(cats []*model.Category) {
+	sort.Slice(cats, func(i, j int) bool { return cats[i].Name < cats[j].Name })
+	for _, cat := range cats {
+		sortCategories(cat.Children)
+	}
+}
+
+// categoryByID category with id; an id that is not a positive integer is reported as not found
+func categoryByID(db *gorm.DB, id string) (*model.Category, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var cat model.Category
+	if err := db.First(&cat, "id = ?", n).Error; err != nil {
+		return nil, err
+	}
+	return &cat, nil
+}
+
+func categoryNotFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No category found with ID", "data": nil})
+}
+
+// GetCategoryTree every category nested under its parent, siblings sorted by name
+func GetCategoryTree(c *fiber.Ctx) error {
+	var all []*model.Category
+	// a path sorts after its ancestors' paths, so parents are placed before their children
+	if err := database.DB.WithContext(c.UserContext()).Order("path").Find(&all).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load categories", "errors": err.Error()})
+	}
+	byID := make(map[uint]*model.Category, len(all))
+	roots := []*model.Category{}
+	for _, cat := range all {
+		byID[cat.ID] = cat
+		if cat.ParentID == nil {
+			roots = append(roots, cat)
+		} else if parent, ok := byID[*cat.ParentID]; ok {
+			parent.Children = append(parent.Children, cat)
+		}
+	}
+	sortCategories(roots)
+	return c.JSON(fiber.Map{"status": "success", "message": "Category tree", "data": roots})
+}
+
+// GetCategory a category with its breadcrumb trail from the root and its direct children
+func GetCategory(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	cat, err := categoryByID(db, c.Params("id"))
+	if err != nil {
+		return categoryNotFound(c)
+	}
+
+	var breadcrumbs []model.Category
+	db.Where("id IN ?", categoryLineage(cat)).Order("length(path)").Find(&breadcrumbs)
+	children := []model.Category{}
+	db.Where("parent_id = ?", cat.ID).Order("name").Find(&children)
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Category found", "data": fiber.Map{"category": cat, "breadcrumbs": breadcrumbs, "children": children}})
+}
+
+// CreateCategory add a category, at the root or under parent_id
+func CreateCategory(c *fiber.Ctx) error {
+	type CategoryInput struct {
+		Name     string `json:"name"`
+		ParentID *uint  `json:"parent_id"`
+	}
+	var input CategoryInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	name := validation.CleanLine(input.Name, maxCategoryNameLength)
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "name is required", "data": nil})
+	}
+
+	cat := model.Category{Name: name, ParentID: input.ParentID}
+	err := database.DB.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		var parent *model.Category
+		if input.ParentID != nil {
+			parent = new(model.Category)
+			if err := tx.First(parent, *input.ParentID).Error; err != nil {
+				return err
+			}
+		}
+		// the path needs the new ID, so it is filled in right after the insert
+		if err := tx.Create(&cat).Error; err != nil {
+			return err
+		}
+		cat.Path = categoryPath(parent, cat.ID)
+		return tx.Model(&cat).Update("path", cat.Path).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "No parent category found with ID", "data": nil})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create category", "errors": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Created category", "data": cat})
+}
+
+// RenameCategory change a category's name
+func RenameCategory(c *fiber.Ctx) error {
+	type RenameInput struct {
+		Name string `json:"name"`
+	}
+	var input RenameInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	name := validation.CleanLine(input.Name, maxCategoryNameLength)
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "name is required", "data": nil})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	cat, err := categoryByID(db, c.Params("id"))
+	if err != nil {
+		return categoryNotFound(c)
+	}
+	if err := db.Model(cat).Update("name", name).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't rename category", "errors": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Category renamed", "data": cat})
+}
+
+// MoveCategory move a category and its subtree under parent_id, or to the root when it is null.
+// Moving a category under itself or one of its descendants is refused.
+func MoveCategory(c *fiber.Ctx) error {
+	type MoveInput struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	var input MoveInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+
+	var cat model.Category
+	err := database.DB.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		// serialize moves so two concurrent ones can't combine into a cycle
+		if err := tx.Exec("LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		found, err := categoryByID(tx, c.Params("id"))
+		if err != nil {
+			return err
+		}
+		cat = *found
+		var parent *model.Category
+		if input.ParentID != nil {
+			parent = new(model.Category)
+			if err := tx.First(parent, *input.ParentID).Error; err != nil {
+				return err
+			}
+			if strings.HasPrefix(parent.Path, cat.Path) {
+				return errCategoryCycle
+			}
+		}
+
+		oldPath, newPath := cat.Path, categoryPath(parent, cat.ID)
+		err = tx.Exec("UPDATE categories SET path = ? || substr(path, ?), updated_at = now() WHERE path LIKE ?",
+			newPath, len(oldPath)+1, oldPath+"%").Error
+		if err != nil {
+			return err
+		}
+		cat.Path, cat.ParentID = newPath, input.ParentID
+		return tx.Model(&cat).Update("parent_id", input.ParentID).Error
+	})
+	if errors.Is(err, errCategoryCycle) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "code": "CATEGORY_CYCLE", "message": "A category can't move under itself or its descendants", "data": nil})
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return categoryNotFound(c)
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't move category", "errors": err.Error()})
+	}
+	middleware.InvalidateCache("products")
+	return c.JSON(fiber.Map{"status": "success", "message": "Category moved", "data": cat})
+}
+
+// DeleteCategory delete a category without subcategories, leaving its products uncategorized
+func DeleteCategory(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	cat, err := categoryByID(db, c.Params("id"))
+	if err != nil {
+		return categoryNotFound(c)
+	}
+	var children int64
+	db.Model(&model.Category{}).Where("parent_id = ?", cat.ID).Count(&children)
+	if children > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Move or delete the subcategories first", "data": nil})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Product{}).Where("category_id = ?", cat.ID).Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(cat).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't delete category", "errors": err.Error()})
+	}
+	middleware.InvalidateCache("products")
+	return c.JSON(fiber.Map{"status": "success", "message": "Category deleted", "data": nil})
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"app/validation"
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+// GetChaos list the fault injection rules in force
+func GetChaos(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "success", "message": "Chaos rules", "data": middleware.ChaosRules()})
+}
+
+// SetChaos replace the fault injection rules on every instance, an empty list stops the drill
+func SetChaos(c *fiber.Ctx) error {
+	type ChaosInput struct {
+		Rules []middleware.ChaosRule `json:"rules" validate:"dive"`
+	}
+	var input ChaosInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	if errs := validation.Struct(&input, c.AcceptsLanguages(validation.Locales...)); errs != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+	if input.Rules == nil {
+		input.Rules = []middleware.ChaosRule{}
+	}
+
+	b, err := json.Marshal(input.Rules)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	setting := model.Setting{Key: middleware.ChaosSetting, Value: string(b)}
+	if err := database.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&setting).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update chaos rules", "errors": err.Error()})
+	}
+	middleware.SetChaosRules(input.Rules)
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Chaos rules updated", "data": input.Rules})
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/config"
+	"app/database"
+	"app/events"
+	"app/mail"
+	"app/middleware"
+	"app/model"
+	"app/random"
+	"app/validation"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// emailChangeTTL how long the confirmation link sent to a new address works
+const emailChangeTTL = 24 * time.Hour
+
+var mailer = mail.New()
+
+func hashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// emailInUse report whether an active account other than userID has email
+func emailInUse(db *gorm.DB, email string, userID uint) bool {
+	var n int64
+	db.Model(&model.User{}).Where("lower(email) = lower(?) AND id <> ?", email, userID).Count(&n)
+	return n > 0
+}
+
+// ChangeMyEmail start changing the caller's email. The new address gets a confirmation link and the
+// current one a notice; the account keeps its email until the link is followed.
+func ChangeMyEmail(c *fiber.Ctx) error {
+	type EmailInput struct {
+		Email string `json:"email" validate:"required,email,not_disposable_email"`
+	}
+	var input EmailInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	if errs := validation.Struct(&input, c.AcceptsLanguages(validation.Locales...)); errs != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+	if strings.EqualFold(input.Email, user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "That is already your email", "data": nil})
+	}
+	if emailInUse(db, input.Email, user.ID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Email is already in use", "data": nil})
+	}
+
+	token, err := random.Hex(32)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	change := model.EmailChange{
+		ExpiresAt: clock.Now().Add(emailChangeTTL),
+		UserID:    user.ID,
+		NewEmail:  input.Email,
+		TokenHash: hashEmailToken(token),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&model.EmailChange{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't start email change", "errors": err.Error()})
+	}
+
+	link := strings.TrimRight(config.Config("APP_URL"), "/") + "/api/user/email/confirm?token=" + url.QueryEscape(token)
+	err = mailer.Send(c.UserContext(), change.NewEmail, "Confirm your new email address",
+		fmt.Sprintf("Follow this link within 24 hours to make %s the email of your account %s:\n\n%s\n", change.NewEmail, user.Username, link))
+	if err != nil {
+		db.Delete(&change)
+		if errors.Is(err, mail.ErrDisabled) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "message": "Email is not available", "data": nil})
+		}
+		log.Printf("failed to send email change confirmation to user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "error", "message": "Couldn't send confirmation email", "data": nil})
+	}
+	notifyEmail(c.UserContext(), user.Email, "Your email address is being changed",
+		fmt.Sprintf("Someone asked to change the email of your account %s to %s. Nothing changes unless the link sent there is followed.\n\n"+
+			"If this wasn't you, change your password and cancel the request with DELETE /api/user/me/email.\n", user.Username, change.NewEmail))
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "success", "message": "Confirmation sent to the new address",
+		"data": fiber.Map{"pending_email": change.NewEmail, "expires_at": change.ExpiresAt}})
+}
+
+// CancelMyEmailChange drop the caller's pending email change
+func CancelMyEmailChange(c *fiber.Ctx) error {
+	res := database.DB.WithContext(c.UserContext()).Where("user_id = ?", middleware.CurrentUser(c).ID).Delete(&model.EmailChange{})
+	if res.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't cancel email change", "errors": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No pending email change", "data": nil})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Email change cancelled", "data": nil})
+}
+
+// ConfirmEmailChange swap in the new email of the change whose link carried ?token
+func ConfirmEmailChange(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	var change model.EmailChange
+	if err := db.Where("token_hash = ? AND expires_at > ?", hashEmailToken(c.Query("token")), clock.Now()).First(&change).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "code": "INVALID_TOKEN", "message": "Invalid or expired confirmation link", "data": nil})
+	}
+	var user model.User
+	if err := db.First(&user, change.UserID).Error; err != nil {
+		db.Delete(&change)
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
+	}
+
+	oldEmail := user.Email
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("email", change.NewEmail).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&change).Error
+	})
+	if database.IsUniqueViolation(err, "idx_users_email_active") {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Email is already in use", "data": nil})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't change email", "errors": err.Error()})
+	}
+	user.Email = change.NewEmail
+	middleware.ForgetUser(user.ID)
+	events.Record(db, events.UserUpdated, "user", user.ID, &user.ID, events.UserSnapshot(&user))
+	audit.Record(c, audit.Entry{Action: audit.EmailChanged, Success: true, ActorID: &user.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	notifyEmail(c.UserContext(), oldEmail, "Your email address was changed",
+		fmt.Sprintf("The email of your account %s is now %s. If this wasn't you, contact support.\n", user.Username, user.Email))
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Email changed", "data": fiber.Map{"email": user.Email}})
+}
+
+// notifyEmail send a best-effort notice, logging failures
+func notifyEmail(ctx context.Context, to, subject, body string) {
+	if err := mailer.Send(ctx, to, subject, body); err != nil && !errors.Is(err, mail.ErrDisabled) {
+		log.Printf("failed to send %q notice: %v", subject, err)
+	}
+}
+
+// PurgeEmailChanges delete email changes whose link expired
+func PurgeEmailChanges(ctx context.Context) error {
+	return database.DB.WithContext(ctx).Where("expires_at < ?", clock.Now()).Delete(&model.EmailChange{}).Error
+}
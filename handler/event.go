@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"app/database"
+	"app/model"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetEvents query the event log in insertion order, resuming after after_id for replays
+func GetEvents(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	query := db.Where("id > ?", c.QueryInt("after_id", 0))
+	if t := c.Query("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+	if t := c.Query("aggregate_type"); t != "" {
+		query = query.Where("aggregate_type = ?", t)
+	}
+	if id := c.QueryInt("aggregate_id", 0); id > 0 {
+		query = query.Where("aggregate_id = ?", id)
+	}
+
+	var events []model.Event
+	if err := query.Order("id").Limit(limit).Find(&events).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't query events", "errors": err.Error()})
+	}
+	cursor := c.Query("after_id", "0")
+	if len(events) > 0 {
+		cursor = strconv.FormatUint(uint64(events[len(events)-1].ID), 10)
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Events",
+		"data":    events,
+		"meta":    fiber.Map{"links": cursorLinks(c, "after_id", cursor, len(events) == limit)},
+	})
+}
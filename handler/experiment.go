@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"app/database"
+	"app/experiments"
+	"app/middleware"
+	"app/model"
+	"app/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetExperiments list every experiment with its variants
+func GetExperiments(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	var list []model.Experiment
+	db.Preload("Variants").Order("id").Find(&list)
+	return c.JSON(fiber.Map{"status": "success", "message": "All experiments", "data": list})
+}
+
+// CreateExperiment new experiment
+func CreateExperiment(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	experiment := new(model.Experiment)
+	if err := c.BodyParser(experiment); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
+	}
+	// client-supplied IDs would let the insert upsert rows belonging to other experiments
+	experiment.ID = 0
+	for i := range experiment.Variants {
+		experiment.Variants[i].ID = 0
+		experiment.Variants[i].ExperimentID = 0
+	}
+	if errs := validation.Struct(experiment, c.AcceptsLanguages(validation.Locales...)); errs != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+
+	if err := db.Create(experiment).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create experiment", "errors": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Created experiment", "data": experiment})
+}
+
+// UpdateExperiment change an experiment's name, state or variants
+func UpdateExperiment(c *fiber.Ctx) error {
+	type UpdateExperimentInput struct {
+		Name     *string                   `json:"name"`
+		Active   *bool                     `json:"active"`
+		Variants []model.ExperimentVariant `validate:"omitempty,min=2,dive" json:"variants"`
+	}
+	var input UpdateExperimentInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
+	}
+	if errs := validation.Struct(&input, c.AcceptsLanguages(validation.Locales...)); errs != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	var experiment model.Experiment
+	id, ok := paramID(c, "id")
+	if !ok || db.First(&experiment, "id = ?", id).Error != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No experiment found with ID", "data": nil})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if input.Name != nil {
+			experiment.Name = *input.Name
+		}
+		if input.Active != nil {
+			experiment.Active = *input.Active
+		}
+		if err := tx.Omit("Variants").Save(&experiment).Error; err != nil {
+			return err
+		}
+		if input.Variants == nil {
+			return nil
+		}
+		if err := tx.Where("experiment_id = ?", experiment.ID).Delete(&model.ExperimentVariant{}).Error; err != nil {
+			return err
+		}
+		for i := range input.Variants {
+			input.Variants[i].ID = 0
+			input.Variants[i].ExperimentID = experiment.ID
+		}
+		return tx.Create(&input.Variants).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update experiment", "errors": err.Error()})
+	}
+
+	db.Preload("Variants").First(&experiment, experiment.ID)
+	return c.JSON(fiber.Map{"status": "success", "message": "Experiment successfully updated", "data": experiment})
+}
+
+// GetExperimentAssignments variant of every active experiment for the caller
+func GetExperimentAssignments(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+
+	var active []model.Experiment
+	db.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Where("active = ?", true).Find(&active)
+
+	assignments := map[string]string{}
+	for i := range active {
+		if variant, ok := experiments.Assign(&active[i], user.ID); ok {
+			assignments[active[i].Key] = variant
+		}
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Experiment assignments", "data": assignments})
+}
+
+// LogExperimentExposure record that the caller was shown their variant of an experiment
+func LogExperimentExposure(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+
+	var experiment model.Experiment
+	err := db.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("key = ? AND active = ?", c.Params("key"), true).First(&experiment).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No active experiment found with key", "data": nil})
+	}
+
+	variant, ok := experiments.Assign(&experiment, user.ID)
+	if !ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Experiment has no traffic", "data": nil})
+	}
+
+	exposure := model.ExperimentExposure{ExperimentID: experiment.ID, UserID: user.ID, Variant: variant}
+	if err := db.Create(&exposure).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't log exposure", "errors": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Exposure logged", "data": exposure})
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"app/config"
+	"app/database"
+	"app/model"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const feedSize = 50
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+}
+
+var feeds struct {
+	sync.RWMutex
+	sitemap []byte
+	rss     []byte
+}
+
+func productURL(base string, id uint) string {
+	return fmt.Sprintf("%s/api/product/%d", base, id)
+}
+
+// RefreshFeeds regenerate the cached sitemap and product feed
+func RefreshFeeds() error {
+	db := database.DB
+	base := strings.TrimRight(config.Config("APP_URL"), "/")
+
+	var products []model.Product
+	if err := db.Scopes(visibleProducts).Select("id", "updated_at").Order("id").Find(&products).Error; err != nil {
+		return err
+	}
+
+	sm := urlSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, p := range products {
+		sm.URLs = append(sm.URLs, sitemapURL{Loc: productURL(base, p.ID), LastMod: p.UpdatedAt.Format("2006-01-02")})
+	}
+
+	var recent []model.Product
+	if err := db.Scopes(visibleProducts).Order("created_at desc").Limit(feedSize).Find(&recent).Error; err != nil {
+		return err
+	}
+
+	feed := rss{Version: "2.0", Channel: rssChannel{Title: "Latest products", Link: base, Description: "Recently published products"}}
+	for _, p := range recent {
+		link := productURL(base, p.ID)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       p.Title,
+			Link:        link,
+			Description: p.Description,
+			GUID:        link,
+			PubDate:     p.CreatedAt.Format(time.RFC1123Z),
+		})
+	}
+
+	smXML, err := xml.Marshal(sm)
+	if err != nil {
+		return err
+	}
+	rssXML, err := xml.Marshal(feed)
+	if err != nil {
+		return err
+	}
+
+	feeds.Lock()
+	feeds.sitemap = append([]byte(xml.Header), smXML...)
+	feeds.rss = append([]byte(xml.Header), rssXML...)
+	feeds.Unlock()
+	return nil
+}
+
+// StartFeedRefresher regenerate feeds every FEED_REFRESH_INTERVAL (default 1h)
+func StartFeedRefresher() {
+	interval, err := time.ParseDuration(config.Config("FEED_REFRESH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := RefreshFeeds(); err != nil {
+				log.Println("failed to generate feeds:", err)
+			}
+		}
+	}()
+}
+
+func cachedFeed(get func() []byte) ([]byte, error) {
+	feeds.RLock()
+	b := get()
+	feeds.RUnlock()
+	if b != nil {
+		return b, nil
+	}
+	if err := RefreshFeeds(); err != nil {
+		return nil, err
+	}
+	feeds.RLock()
+	defer feeds.RUnlock()
+	return get(), nil
+}
+
+// Sitemap serve sitemap.xml of public products
+func Sitemap(c *fiber.Ctx) error {
+	b, err := cachedFeed(func() []byte { return feeds.sitemap })
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Type("xml")
+	return c.Send(b)
+}
+
+// Feed serve RSS feed of recently published products
+func Feed(c *fiber.Ctx) error {
+	b, err := cachedFeed(func() []byte { return feeds.rss })
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Set(fiber.HeaderContentType, "application/rss+xml; charset=utf-8")
+	return c.Send(b)
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"app/random"
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// guestTTL lifetime of a guest token, and of the guest account behind it
+const guestTTL = 30 * 24 * time.Hour
+
+// guestScopes what a guest token may do: browse and create products
+var guestScopes = []interface{}{middleware.ScopeProductsRead, middleware.ScopeProductsWrite}
+
+// CreateGuest issue a scoped token for a new synthetic guest account, so visitors can
+// create data before signing up. Registering with the token moves that data to the new account.
+func CreateGuest(c *fiber.Ctx) error {
+	name, err := random.Hex(6)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	guest := &model.User{
+		Username: "guest-" + name,
+		Email:    "guest-" + name + "@guest.invalid",
+		Role:     model.RoleGuest,
+	}
+	if err := database.DB.WithContext(c.UserContext()).Create(guest).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create guest", "errors": err.Error()})
+	}
+
+	t, err := signToken(guest.ID, guest.Username, guestTTL, jwt.MapClaims{"scopes": guestScopes})
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Guest session started", "data": fiber.Map{
+		"token":      deliverToken(c, t, guestTTL),
+		"username":   guest.Username,
+		"expires_in": int(guestTTL.Seconds()),
+	}})
+}
+
+// mergeGuest move what the guest behind the request's token created to user and retire the guest.
+// Requests without a guest token are left alone.
+func mergeGuest(c *fiber.Ctx, user *model.User) error {
+	auth, err := middleware.Claims(c)
+	if err != nil {
+		return nil
+	}
+	var guest model.User
+	if err := database.DB.WithContext(c.UserContext()).Where("role = ?", model.RoleGuest).Limit(1).Find(&guest, auth.UserID).Error; err != nil || guest.ID == 0 {
+		return err
+	}
+
+	err = database.DB.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Product{}).Where("created_by = ?", guest.ID).UpdateColumn("created_by", user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Product{}).Where("updated_by = ?", guest.ID).UpdateColumn("updated_by", user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.ProductView{}).Where("user_id = ?", guest.ID).UpdateColumn("user_id", user.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&guest).Error
+	})
+	if err != nil {
+		return err
+	}
+	middleware.ForgetUser(guest.ID)
+	audit.Record(c, audit.Entry{Action: audit.GuestUpgraded, Success: true, ActorID: &user.ID, TargetType: "user", TargetID: audit.Target(guest.ID)})
+	return nil
+}
+
+// PurgeGuests delete guest accounts whose tokens have expired without being upgraded
+func PurgeGuests(ctx context.Context) error {
+	return database.DB.WithContext(ctx).
+		Where("role = ? AND created_at < ?", model.RoleGuest, clock.Now().Add(-guestTTL)).
+		Delete(&model.User{}).Error
+}
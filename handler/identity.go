@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"app/audit"
+	"app/database"
+	"app/middleware"
+	"app/model"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// linkIdentity record that the user signs in through provider as subject, a no-op when already linked
+func linkIdentity(db *gorm.DB, userID uint, provider, subject string) error {
+	identity := model.Identity{UserID: userID, Provider: provider, ProviderUserID: subject}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&identity).Error
+}
+
+// lastIdentity report whether the user's only identity is of provider, so removing it would lock them out
+func lastIdentity(db *gorm.DB, userID uint, provider string) bool {
+	var identities []model.Identity
+	db.Where("user_id = ?", userID).Limit(2).Find(&identities)
+	return len(identities) == 1 && identities[0].Provider == provider
+}
+
+func lastIdentityConflict(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "code": "LAST_IDENTITY", "message": "Can't remove the only way to sign in to this account", "data": nil})
+}
+
+// GetMyIdentities ways the caller can sign in
+func GetMyIdentities(c *fiber.Ctx) error {
+	var identities []model.Identity
+	if err := database.DB.WithContext(c.UserContext()).Where("user_id = ?", middleware.CurrentUser(c).ID).Order("id").Find(&identities).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't list identities", "errors": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Identities", "data": identities})
+}
+
+// UnlinkMyIdentity remove a way of signing in, dropping the password or phone number behind it.
+// The last identity can't be removed.
+func UnlinkMyIdentity(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+
+	var identity model.Identity
+	id, ok := paramID(c, "identityId")
+	if !ok || db.Where("id = ? AND user_id = ?", id, user.ID).First(&identity).Error != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No identity found with ID", "data": nil})
+	}
+	if lastIdentity(db, user.ID, identity.Provider) {
+		return lastIdentityConflict(c)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+		switch identity.Provider {
+		case model.ProviderPassword:
+			return tx.Model(user).Update("password", "").Error
+		case model.ProviderPhone:
+			return tx.Model(user).Updates(map[string]interface{}{"phone_number": nil, "phone_verified_at": nil}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't unlink identity", "errors": err.Error()})
+	}
+	middleware.ForgetUser(user.ID)
+	audit.Record(c, audit.Entry{Action: audit.IdentityUnlinked, Success: true, ActorID: &user.ID, TargetType: "user", TargetID: audit.Target(user.ID),
+		Details: map[string]interface{}{"provider": identity.Provider}})
+	return c.JSON(fiber.Map{"status": "success", "message": "Identity unlinked", "data": nil})
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"app/audit"
+	"app/database"
+	"app/events"
+	"app/jobs"
+	"app/middleware"
+	"app/model"
+	"app/random"
+	"app/validation"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const maxImportRows = 1000
+
+var usernameUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+type importRow struct {
+	Email string `validate:"required,email,not_disposable_email" json:"email"`
+	Names string `validate:"max=255" json:"names"`
+	Role  string `validate:"omitempty,oneof=user admin" json:"role"`
+}
+
+type importResult struct {
+	Row    int    `json:"row"`
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	UserID uint   `json:"user_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importReader CSV from a completed resumable upload named by ?upload_id, the multipart "file" field, or the raw request body
+func importReader(c *fiber.Ctx) (io.Reader, error) {
+	if id := c.Query("upload_id"); id != "" {
+		data, err := completedUpload(c, id)
+		if err != nil {
+			return nil, errors.New("no completed upload with ID " + id)
+		}
+		return bytes.NewReader(data), nil
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return bytes.NewReader(c.Body()), nil
+	}
+	return fh.Open()
+}
+
+// invitedUsername username derived from the email's local part, suffixed when already taken
+func invitedUsername(db *gorm.DB, email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	name := strings.Trim(usernameUnsafe.ReplaceAllString(local, "-"), "._-")
+	if len(name) < 3 {
+		name = "user-" + name
+	}
+	if len(name) > 40 {
+		name = name[:40]
+	}
+
+	var taken int64
+	db.Model(&model.User{}).Where("username = ?", name).Count(&taken)
+	if taken == 0 {
+		return name
+	}
+	suffix, err := random.Hex(3)
+	if err != nil {
+		return name
+	}
+	return name + "-" + suffix
+}
+
+// inviteUser create an invited account for one CSV row on behalf of the admin adminID,
+// with validation messages in locale
+func inviteUser(db *gorm.DB, row importRow, locale string, adminID uint) (*model.User, error) {
+	if errs := validation.Struct(&row, locale); errs != nil {
+		var msgs []string
+		for _, msg := range errs {
+			msgs = append(msgs, msg)
+		}
+		return nil, errors.New(strings.Join(msgs, "; "))
+	}
+
+	var existing int64
+	db.Model(&model.User{}).Where("lower(email) = lower(?)", row.Email).Count(&existing)
+	if existing > 0 {
+		return nil, errors.New("email already registered")
+	}
+
+	role := row.Role
+	if role == "" {
+		role = model.RoleUser
+	}
+	now := time.Now()
+	user := &model.User{
+		Username:  invitedUsername(db, row.Email),
+		Email:     row.Email,
+		Names:     row.Names,
+		Role:      role,
+		InvitedAt: &now,
+	}
+	// the derived username can be claimed between the check and the insert; draw another
+	for attempt := 0; ; attempt++ {
+		err := db.Create(user).Error
+		if err == nil {
+			break
+		}
+		if attempt == 2 || !database.IsUniqueViolation(err, "idx_users_username_active") {
+			return nil, err
+		}
+		user.ID = 0
+		user.Username = invitedUsername(db, row.Email)
+	}
+
+	events.Record(db, events.UserCreated, "user", user.ID, &adminID, events.UserSnapshot(user))
+	return user, nil
+}
+
+// AdminImportUsers pre-provision invited users from a CSV with an email, names and role header.
+// Rows are independent: a bad row is reported and the rest are still imported.
+func AdminImportUsers(c *fiber.Ctx) error {
+	src, err := importReader(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Couldn't read upload", "errors": err.Error()})
+	}
+	if closer, ok := src.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	r := csv.NewReader(src)
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Missing CSV header", "errors": err.Error()})
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["email"]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "CSV header must include an email column", "data": nil})
+	}
+	field := func(record []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Malformed CSV", "errors": err.Error()})
+	}
+	if len(records) > maxImportRows {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("Import at most %d rows at a time", maxImportRows), "data": nil})
+	}
+
+	rows := make([]importRow, len(records))
+	for i, record := range records {
+		rows[i] = importRow{Email: field(record, "email"), Names: validation.CleanLine(field(record, "names"), maxNamesLength), Role: field(record, "role")}
+	}
+	admin := middleware.CurrentUser(c)
+	locale := c.AcceptsLanguages(validation.Locales...)
+	asCSV := c.Query("format") == "csv"
+
+	if c.QueryBool("async") {
+		adminID := admin.ID
+		job, err := jobs.Start(adminID, "users.import", func(ctx context.Context, r *jobs.Reporter) (*jobs.Result, error) {
+			db := database.DB.WithContext(database.WithActor(ctx, adminID))
+			results, _ := importRows(db, rows, locale, adminID, r)
+			body, contentType, name, err := importReport(results, asCSV)
+			if err != nil {
+				return nil, err
+			}
+			return &jobs.Result{Body: body, ContentType: contentType, Filename: name}, nil
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't start import", "errors": err.Error()})
+		}
+		audit.Record(c, audit.Entry{Action: audit.UsersImported, Success: true, ActorID: &admin.ID, TargetType: "user",
+			Details: map[string]interface{}{"rows": len(rows), "job_id": job.ID}})
+		return jobAccepted(c, job)
+	}
+
+	results, created := importRows(database.DB.WithContext(c.UserContext()), rows, locale, admin.ID, nil)
+	audit.Record(c, audit.Entry{Action: audit.UsersImported, Success: true, ActorID: &admin.ID, TargetType: "user",
+		Details: map[string]interface{}{"invited": created, "failed": len(results) - created}})
+
+	if asCSV {
+		body, contentType, name, err := importReport(results, true)
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Attachment(name)
+		return c.Send(body)
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("Invited %d of %d users", created, len(results)), "data": results})
+}
+
+// importRows invite each row, reporting progress and failed rows to r when it is set
+func importRows(db *gorm.DB, rows []importRow, locale string, adminID uint, r *jobs.Reporter) ([]importResult, int) {
+	results := make([]importResult, 0, len(rows))
+	created := 0
+	for i, row := range rows {
+		// row numbers match the spreadsheet, counting the header as row 1
+		user, err := inviteUser(db, row, locale, adminID)
+		if err != nil {
+			results = append(results, importResult{Row: i + 2, Email: row.Email, Status: "error", Error: err.Error()})
+			if r != nil {
+				r.Error(fmt.Sprintf("row %d: %v", i+2, err))
+			}
+		} else {
+			created++
+			results = append(results, importResult{Row: i + 2, Email: user.Email, Status: "invited", UserID: user.ID})
+		}
+		if r != nil {
+			r.Progress(i+1, len(rows))
+		}
+	}
+	return results, created
+}
+
+// importReport the import results as a CSV or JSON document
+func importReport(results []importResult, asCSV bool) (body []byte, contentType, name string, err error) {
+	if !asCSV {
+		body, err = json.Marshal(results)
+		return body, fiber.MIMEApplicationJSON, "import-report.json", err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"row", "email", "status", "user_id", "error"})
+	for _, res := range results {
+		id := ""
+		if res.UserID != 0 {
+			id = strconv.FormatUint(uint64(res.UserID), 10)
+		}
+		w.Write([]string{strconv.Itoa(res.Row), res.Email, res.Status, id, res.Error})
+	}
+	w.Flush()
+	return buf.Bytes(), "text/csv; charset=utf-8", "import-report.csv", w.Error()
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// jobByID job visible to the caller, their own or any job for admins, without its result
+func jobByID(c *fiber.Ctx, id string) (*model.Job, error) {
+	user := middleware.CurrentUser(c)
+	query := database.DB.Omit("result")
+	if user.Role != model.RoleAdmin {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	var job model.Job
+	if err := query.First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// jobLinks self link of a job, and its result link once there is one
+func jobLinks(c *fiber.Ctx, job *model.Job) fiber.Map {
+	self := c.BaseURL() + "/api/jobs/" + strconv.FormatUint(uint64(job.ID), 10)
+	links := fiber.Map{"self": self, "result": nil}
+	if job.Status == model.JobSucceeded && job.ResultType != "" {
+		links["result"] = self + "/result"
+	}
+	return links
+}
+
+// jobAccepted answer 202 for a job started in the background, pointing at where to poll it
+func jobAccepted(c *fiber.Ctx, job *model.Job) error {
+	links := jobLinks(c, job)
+	c.Location(links["self"].(string))
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "success", "message": "Job started", "data": job, "meta": fiber.Map{"links": links}})
+}
+
+// GetJob status, progress and errors of a job
+func GetJob(c *fiber.Ctx) error {
+	job, err := jobByID(c, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No job found with ID", "data": nil})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Job found", "data": job, "meta": fiber.Map{"links": jobLinks(c, job)}})
+}
+
+// GetJobResult download what a succeeded job produced
+func GetJobResult(c *fiber.Ctx) error {
+	job, err := jobByID(c, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No job found with ID", "data": nil})
+	}
+	if job.Status != model.JobSucceeded || job.ResultType == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Job has no result yet", "data": job})
+	}
+
+	var result model.Job
+	if err := database.DB.WithContext(c.UserContext()).Select("result").First(&result, job.ID).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load job result", "errors": err.Error()})
+	}
+	c.Set(fiber.HeaderContentType, job.ResultType)
+	if job.ResultName != "" {
+		c.Attachment(job.ResultName)
+	}
+	return c.Send(result.Result)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"app/clock"
+	"app/config"
+	"app/model"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// productLimits caps on the products one user can create, 0 meaning no cap
+type productLimits struct {
+	// Daily products created in the last 24 hours, deleted ones included
+	Daily int
+	// Total products the user currently has
+	Total int
+}
+
+func limitFromEnv(key string) int {
+	n, err := strconv.Atoi(config.Config(key))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// productLimitsFor caps that apply to user: none for admins, PRODUCT_DAILY_LIMIT and PRODUCT_TOTAL_LIMIT
+// for everyone else. Per-plan limits go here once accounts have plans.
+func productLimitsFor(user *model.User) productLimits {
+	if user.Role == model.RoleAdmin {
+		return productLimits{}
+	}
+	return productLimits{Daily: limitFromEnv("PRODUCT_DAILY_LIMIT"), Total: limitFromEnv("PRODUCT_TOTAL_LIMIT")}
+}
+
+// productLimitError a new product would take the user past one of their caps
+type productLimitError struct {
+	status  int
+	code    string
+	message string
+	limit   int
+}
+
+func (e *productLimitError) Error() string {
+	return e.message
+}
+
+func (e *productLimitError) respond(c *fiber.Ctx) error {
+	return c.Status(e.status).JSON(fiber.Map{"status": "error", "code": e.code, "message": e.message, "data": fiber.Map{"limit": e.limit}})
+}
+
+// checkProductLimits return a *productLimitError when user may not create another product. It must run in
+// the transaction that inserts the product: it holds a per-user lock until commit so parallel requests
+// can't all pass the same count.
+func checkProductLimits(tx *gorm.DB, user *model.User) error {
+	limits := productLimitsFor(user)
+	if limits.Daily == 0 && limits.Total == 0 {
+		return nil
+	}
+	// the two-key form keeps these locks apart from the single-key ones taken by database.WithAdvisoryLock
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('product_limits'), ?)", int32(user.ID)).Error; err != nil {
+		return err
+	}
+	if limits.Daily > 0 {
+		var today int64
+		err := tx.Unscoped().Model(&model.Product{}).
+			Where("created_by = ? AND created_at > ?", user.ID, clock.Now().Add(-24*time.Hour)).
+			Count(&today).Error
+		if err != nil {
+			return err
+		}
+		if today >= int64(limits.Daily) {
+			return &productLimitError{status: fiber.StatusTooManyRequests, code: "PRODUCT_DAILY_LIMIT",
+				message: fmt.Sprintf("You can create at most %d products a day", limits.Daily), limit: limits.Daily}
+		}
+	}
+	if limits.Total > 0 {
+		var total int64
+		if err := tx.Model(&model.Product{}).Where("created_by = ?", user.ID).Count(&total).Error; err != nil {
+			return err
+		}
+		if total >= int64(limits.Total) {
+			return &productLimitError{status: fiber.StatusForbidden, code: "PRODUCT_TOTAL_LIMIT",
+				message: fmt.Sprintf("You can have at most %d products", limits.Total), limit: limits.Total}
+		}
+	}
+	return nil
+}
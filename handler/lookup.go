@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// productByID product with id, loaded at most once per request.
+// An id that is not a positive integer is reported as not found.
+func productByID(c *fiber.Ctx, id string) (*model.Product, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return middleware.Memo(c, productMemoKey(n), func() (*model.Product, error) {
+		var product model.Product
+		if err := database.DB.WithContext(c.UserContext()).First(&product, "id = ?", n).Error; err != nil {
+			return nil, err
+		}
+		return &product, nil
+	})
+}
+
+// productMemoKey request memo key of the product with id
+func productMemoKey(id uint) string {
+	return "product:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// userByID user with id, loaded at most once per request.
+// An id that is not a positive integer is reported as not found.
+func userByID(c *fiber.Ctx, id string) (*model.User, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return middleware.Memo(c, "user:"+strconv.FormatUint(uint64(n), 10), func() (*model.User, error) {
+		var user model.User
+		if err := database.DB.WithContext(c.UserContext()).First(&user, "id = ?", n).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	})
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/database"
+	"app/jobs"
+	"app/middleware"
+	"app/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// moderationSyncMax largest set moderated within the request; bigger ones run as a job
+	moderationSyncMax = 500
+	moderationBatch   = 500
+	moderationSample  = 20
+)
+
+// visibleProducts scope leaving out products hidden by moderation
+func visibleProducts(db *gorm.DB) *gorm.DB {
+	return db.Where("products.hidden_at IS NULL")
+}
+
+// moderationFilter products a bulk moderation action applies to; at least one field must be set
+type moderationFilter struct {
+	// UserID products created by this user
+	UserID *uint `json:"user_id"`
+	// Query case-insensitive substring of the title or description
+	Query string `json:"q"`
+	// From and To range of created_at, From inclusive and To exclusive
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+}
+
+type moderationInput struct {
+	// Action hide or unhide
+	Action string           `json:"action"`
+	Filter moderationFilter `json:"filter"`
+}
+
+// parseModeration read the action and filter, writing the error response when they're invalid
+func parseModeration(c *fiber.Ctx) (*moderationInput, error) {
+	var input moderationInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return nil, err
+	}
+	if input.Action != "hide" && input.Action != "unhide" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "action must be hide or unhide", "data": nil})
+	}
+	f := &input.Filter
+	f.Query = strings.TrimSpace(f.Query)
+	if f.UserID == nil && f.Query == "" && f.From == nil && f.To == nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "filter needs at least one of user_id, q, from or to", "data": nil})
+	}
+	return &input, nil
+}
+
+// query products matching the filter that the action would change
+func (in *moderationInput) query(db *gorm.DB) *gorm.DB {
+	f := in.Filter
+	q := db.Model(&model.Product{})
+	if in.Action == "hide" {
+		q = q.Where("hidden_at IS NULL")
+	} else {
+		q = q.Where("hidden_at IS NOT NULL")
+	}
+	if f.UserID != nil {
+		q = q.Where("created_by = ?", *f.UserID)
+	}
+	if f.Query != "" {
+		like := "%" + likeEscaper.Replace(strings.ToLower(f.Query)) + "%"
+		q = q.Where("(lower(title) LIKE ? OR lower(description) LIKE ?)", like, like)
+	}
+	if f.From != nil {
+		q = q.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		q = q.Where("created_at < ?", *f.To)
+	}
+	return q
+}
+
+// pastTense action as it reads once done
+func (in *moderationInput) pastTense() string {
+	if in.Action == "hide" {
+		return "hidden"
+	}
+	return "unhidden"
+}
+
+// auditAction audit log action recorded for the moderation action
+func (in *moderationInput) auditAction() string {
+	if in.Action == "hide" {
+		return audit.ProductsHidden
+	}
+	return audit.ProductsUnhidden
+}
+
+// moderateProducts apply the action to every matching product in batches, returning the IDs changed.
+// Progress goes to r when it is set.
+func moderateProducts(db *gorm.DB, in *moderationInput, r *jobs.Reporter) ([]uint, error) {
+	var ids []uint
+	if err := in.query(db).Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	var hiddenAt interface{}
+	if in.Action == "hide" {
+		hiddenAt = clock.Now()
+	}
+	changed := make([]uint, 0, len(ids))
+	for start := 0; start < len(ids); start += moderationBatch {
+		batch := ids[start:min(start+moderationBatch, len(ids))]
+		var locked []uint
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// re-apply the filter under lock, skipping products changed since the IDs were read
+			err := in.query(tx).Where("id IN ?", batch).Clauses(clause.Locking{Strength: "UPDATE"}).Pluck("id", &locked).Error
+			if err != nil || len(locked) == 0 {
+				return err
+			}
+			return tx.Model(&model.Product{}).Where("id IN ?", locked).Update("hidden_at", hiddenAt).Error
+		})
+		if err != nil {
+			return changed, err
+		}
+		tags := make([]string, 0, len(locked)+1)
+		tags = append(tags, "products")
+		for _, id := range locked {
+			tags = append(tags, "product:"+strconv.FormatUint(uint64(id), 10))
+		}
+		middleware.InvalidateCache(tags...)
+		changed = append(changed, locked...)
+		if r != nil {
+			r.Progress(start+len(batch), len(ids))
+		}
+	}
+	return changed, nil
+}
+
+// PreviewProductModeration count and sample of the products a bulk moderation action would change
+func PreviewProductModeration(c *fiber.Ctx) error {
+	in, err := parseModeration(c)
+	if in == nil {
+		return err
+	}
+	db := database.DB.WithContext(c.UserContext())
+	var total int64
+	if err := in.query(db).Count(&total).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't count products", "errors": err.Error()})
+	}
+	sample := []model.Product{}
+	if err := in.query(db).Order("id").Limit(moderationSample).Find(&sample).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load products", "errors": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("%d products would be affected", total), "data": fiber.Map{
+		"action": in.Action,
+		"total":  total,
+		"async":  total > moderationSyncMax,
+		"sample": sample,
+	}})
+}
+
+// ModerateProducts hide or unhide every product matching the filter. Sets larger than
+// moderationSyncMax, or any set with ?async=true, are changed by a job.
+func ModerateProducts(c *fiber.Ctx) error {
+	in, err := parseModeration(c)
+	if in == nil {
+		return err
+	}
+	adminID := middleware.CurrentUser(c).ID
+	origin := audit.From(c)
+	record := func(ids []uint, err error, jobID uint) {
+		details := map[string]interface{}{"filter": in.Filter, "count": len(ids), "product_ids": ids}
+		if jobID != 0 {
+			details["job_id"] = jobID
+		}
+		if err != nil {
+			details["error"] = err.Error()
+		}
+		audit.RecordFrom(origin, audit.Entry{Action: in.auditAction(), Success: err == nil, ActorID: &adminID, TargetType: "product", Details: details})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	var total int64
+	if err := in.query(db).Count(&total).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't count products", "errors": err.Error()})
+	}
+
+	if c.QueryBool("async") || total > moderationSyncMax {
+		job, err := jobs.Start(adminID, "products.moderate", func(ctx context.Context, r *jobs.Reporter) (*jobs.Result, error) {
+			ids, err := moderateProducts(database.DB.WithContext(database.WithActor(ctx, adminID)), in, r)
+			record(ids, err, r.JobID())
+			if err != nil {
+				return nil, err
+			}
+			body, err := json.Marshal(fiber.Map{"action": in.Action, "count": len(ids), "product_ids": ids})
+			if err != nil {
+				return nil, err
+			}
+			return &jobs.Result{Body: body, ContentType: fiber.MIMEApplicationJSON, Filename: "moderation.json"}, nil
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't start moderation", "errors": err.Error()})
+		}
+		return jobAccepted(c, job)
+	}
+
+	ids, err := moderateProducts(db, in, nil)
+	record(ids, err, 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't moderate products", "errors": err.Error(), "data": fiber.Map{"product_ids": ids}})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("%d products %s", len(ids), in.pastTense()), "data": fiber.Map{
+		"action":      in.Action,
+		"count":       len(ids),
+		"product_ids": ids,
+	}})
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/config"
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"app/random"
+	"app/sms"
+	"app/validation"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	otpTTL         = 5 * time.Minute
+	otpResendDelay = time.Minute
+	otpMaxAttempts = 5
+)
+
+var smsSender = sms.New()
+
+var errOTPTooSoon = errors.New("a code was sent less than a minute ago")
+
+// hashOTP HMAC of code bound to the phone and purpose it was issued for
+func hashOTP(code, phone, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(config.Config("SECRET")))
+	mac.Write([]byte(purpose + ":" + phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendOTP text a fresh six-digit code for purpose to phone, replacing the user's previous one
+func sendOTP(ctx context.Context, userID uint, phone, purpose string) error {
+	db := database.DB.WithContext(ctx)
+	var recent int64
+	db.Model(&model.OTPCode{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, clock.Now().Add(-otpResendDelay)).
+		Count(&recent)
+	if recent > 0 {
+		return errOTPTooSoon
+	}
+
+	b, err := random.Bytes(4)
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", binary.BigEndian.Uint32(b)%1000000)
+	otp := model.OTPCode{
+		ExpiresAt: clock.Now().Add(otpTTL),
+		UserID:    userID,
+		Purpose:   purpose,
+		Phone:     phone,
+		CodeHash:  hashOTP(code, phone, purpose),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&model.OTPCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&otp).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := smsSender.Send(ctx, phone, "Your verification code is "+code); err != nil {
+		db.Delete(&otp)
+		return err
+	}
+	return nil
+}
+
+// checkOTP consume the user's code for purpose if it matches, counting failed attempts
+func checkOTP(db *gorm.DB, userID uint, phone, purpose, code string) bool {
+	var otp model.OTPCode
+	err := db.Where("user_id = ? AND purpose = ? AND phone = ? AND expires_at > ? AND attempts < ?",
+		userID, purpose, phone, clock.Now(), otpMaxAttempts).
+		Order("id desc").First(&otp).Error
+	if err != nil {
+		return false
+	}
+	if !hmac.Equal([]byte(otp.CodeHash), []byte(hashOTP(code, phone, purpose))) {
+		db.Model(&otp).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		return false
+	}
+	db.Delete(&otp)
+	return true
+}
+
+func smsUnavailable(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "message": "SMS codes are not available", "data": nil})
+}
+
+// SetMyPhone set the caller's phone number and text it a code to verify it with
+func SetMyPhone(c *fiber.Ctx) error {
+	type PhoneInput struct {
+		PhoneNumber string `json:"phone_number" validate:"required,e164_phone"`
+	}
+	var input PhoneInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	if errs := validation.Struct(&input, c.AcceptsLanguages(validation.Locales...)); errs != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+	if lastIdentity(db, user.ID, model.ProviderPhone) {
+		return lastIdentityConflict(c)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND provider = ?", user.ID, model.ProviderPhone).Delete(&model.Identity{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{"phone_number": input.PhoneNumber, "phone_verified_at": nil}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update phone number", "errors": err.Error()})
+	}
+	middleware.ForgetUser(user.ID)
+
+	if err := sendOTP(c.UserContext(), user.ID, input.PhoneNumber, model.OTPVerifyPhone); errors.Is(err, errOTPTooSoon) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"status": "error", "message": "A code was sent less than a minute ago", "data": nil})
+	} else if errors.Is(err, sms.ErrDisabled) {
+		return smsUnavailable(c)
+	} else if err != nil {
+		log.Printf("failed to send phone verification code to user %d: %v", user.ID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "error", "message": "Couldn't send verification code", "data": nil})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "success", "message": "Verification code sent", "data": fiber.Map{"phone_number": input.PhoneNumber, "verified": false}})
+}
+
+// VerifyMyPhone confirm the caller's phone number with the code texted to it
+func VerifyMyPhone(c *fiber.Ctx) error {
+	type CodeInput struct {
+		Code string `json:"code"`
+	}
+	var input CodeInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+
+	user := middleware.CurrentUser(c)
+	if user.PhoneNumber == nil || !checkOTP(database.DB.WithContext(c.UserContext()), user.ID, *user.PhoneNumber, model.OTPVerifyPhone, input.Code) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "code": "INVALID_CODE", "message": "Invalid or expired code", "data": nil})
+	}
+
+	now := clock.Now()
+	phone := *user.PhoneNumber
+	err := database.DB.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("phone_verified_at", &now).Error; err != nil {
+			return err
+		}
+		// a deleted account no longer holds its number, matching idx_users_phone_verified
+		err := tx.Where("provider = ? AND provider_user_id = ? AND user_id IN (?)", model.ProviderPhone, phone,
+			tx.Unscoped().Model(&model.User{}).Select("id").Where("deleted_at IS NOT NULL")).
+			Delete(&model.Identity{}).Error
+		if err != nil {
+			return err
+		}
+		return linkIdentity(tx, user.ID, model.ProviderPhone, phone)
+	})
+	if database.IsUniqueViolation(err, "idx_users_phone_verified") {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Phone number is verified on another account", "data": nil})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't verify phone number", "errors": err.Error()})
+	}
+	middleware.ForgetUser(user.ID)
+	audit.Record(c, audit.Entry{Action: audit.PhoneVerified, Success: true, ActorID: &user.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
+	return c.JSON(fiber.Map{"status": "success", "message": "Phone number verified", "data": fiber.Map{"phone_number": phone, "verified": true}})
+}
+
+// userByVerifiedPhone active user whose verified phone number is phone
+func userByVerifiedPhone(db *gorm.DB, phone string) (*model.User, error) {
+	var user model.User
+	err := db.Where("phone_number = ? AND phone_verified_at IS NOT NULL", phone).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequestLoginOTP text a login code to a verified phone number. The answer is the same whether
+// or not the number belongs to an account, so it cannot be used to find users.
+func RequestLoginOTP(c *fiber.Ctx) error {
+	type OTPRequestInput struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	var input OTPRequestInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	if config.Config("SMS_PROVIDER") == "" {
+		return smsUnavailable(c)
+	}
+
+	if user, err := userByVerifiedPhone(database.DB.WithContext(c.UserContext()), input.PhoneNumber); err == nil && user.SuspendedAt == nil {
+		if err := sendOTP(c.UserContext(), user.ID, input.PhoneNumber, model.OTPLogin); err != nil && !errors.Is(err, errOTPTooSoon) {
+			log.Printf("failed to send login code to user %d: %v", user.ID, err)
+		}
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "success", "message": "If the number belongs to an account, a code is on its way", "data": nil})
+}
+
+// VerifyLoginOTP log in with a phone number and the code texted to it
+func VerifyLoginOTP(c *fiber.Ctx) error {
+	type OTPVerifyInput struct {
+		PhoneNumber string `json:"phone_number"`
+		Code        string `json:"code"`
+		RememberMe  bool   `json:"remember_me"`
+	}
+	var input OTPVerifyInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	user, err := userByVerifiedPhone(db, input.PhoneNumber)
+	if err != nil || !checkOTP(db, user.ID, input.PhoneNumber, model.OTPLogin, input.Code) {
+		entry := audit.Entry{Action: audit.LoginFailed, Details: map[string]interface{}{"reason": "invalid code", "method": "sms"}}
+		if user != nil {
+			entry.ActorID = &user.ID
+		}
+		audit.Record(c, entry)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "error", "code": "INVALID_CODE", "message": "Invalid or expired code", "data": nil})
+	}
+	return startSession(c, user, input.RememberMe, "sms")
+}
+
+// PurgeOTPCodes delete expired one-time codes
+func PurgeOTPCodes(ctx context.Context) error {
+	return database.DB.WithContext(ctx).Where("expires_at < ?", clock.Now()).Delete(&model.OTPCode{}).Error
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// pageURL the request's URL with each of set replacing its query param
+func pageURL(c *fiber.Ctx, set map[string]string) string {
+	args := fasthttp.AcquireArgs()
+	defer fasthttp.ReleaseArgs(args)
+	c.Request().URI().QueryArgs().CopyTo(args)
+	for k, v := range set {
+		args.Set(k, v)
+	}
+	return c.BaseURL() + c.Path() + "?" + args.String()
+}
+
+// setLinks write links as an RFC 8288 Link header and return them for the response meta
+func setLinks(c *fiber.Ctx, links fiber.Map) fiber.Map {
+	parts := make([]string, 0, len(links))
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if url, ok := links[rel].(string); ok {
+			parts = append(parts, "<"+url+`>; rel="`+rel+`"`)
+		}
+	}
+	if len(parts) > 0 {
+		c.Set(fiber.HeaderLink, strings.Join(parts, ", "))
+	}
+	return links
+}
+
+// pageLinks first, prev, next and last links of a page-numbered list; prev and next are nil at the ends
+func pageLinks(c *fiber.Ctx, page, perPage int, total int64) fiber.Map {
+	last := int((total + int64(perPage) - 1) / int64(perPage))
+	if last < 1 {
+		last = 1
+	}
+	at := func(p int) string {
+		return pageURL(c, map[string]string{"page": strconv.Itoa(p), "per_page": strconv.Itoa(perPage)})
+	}
+
+	links := fiber.Map{"first": at(1), "last": at(last), "prev": nil, "next": nil}
+	if page > 1 {
+		links["prev"] = at(min(page-1, last))
+	}
+	if page < last {
+		links["next"] = at(page + 1)
+	}
+	return setLinks(c, links)
+}
+
+// cursorLinks next link of a cursor-paginated list, nil when the page wasn't full
+func cursorLinks(c *fiber.Ctx, param, cursor string, full bool) fiber.Map {
+	links := fiber.Map{"next": nil}
+	if full {
+		links["next"] = pageURL(c, map[string]string{param: cursor})
+	}
+	return setLinks(c, links)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// paramID route parameter name as a record ID; ok is false unless it is a positive integer.
+// Pass the result to queries as a bound value, never the raw parameter.
+func paramID(c *fiber.Ctx, name string) (id uint, ok bool) {
+	return parseID(c.Params(name))
+}
+
+// parseID s as a record ID; ok is false unless it is a positive integer
+func parseID(s string) (id uint, ok bool) {
+	n, err := strconv.ParseUint(s, 10, 0)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// jsonFields collect the lower-cased JSON keys a struct type accepts
+func jsonFields(t reflect.Type, fields map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			jsonFields(f.Type, fields)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+}
+
+// strictBodyParser decode a JSON body into out, rejecting keys out does not declare.
+// It returns the unexpected keys, or an error when the body is not valid JSON.
+func strictBodyParser(c *fiber.Ctx, out interface{}) ([]string, error) {
+	body := c.Body()
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	allowed := map[string]bool{}
+	jsonFields(reflect.TypeOf(out), allowed)
+
+	var unknown []string
+	for key := range raw {
+		if !allowed[strings.ToLower(key)] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return unknown, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	return nil, dec.Decode(out)
+}
+
+// parseStrict run strictBodyParser and write the 400 response on failure.
+// The returned bool reports whether the handler may continue.
+func parseStrict(c *fiber.Ctx, out interface{}) (bool, error) {
+	unknown, err := strictBodyParser(c, out)
+	if err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
+	}
+	if len(unknown) > 0 {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Unexpected fields in request body", "errors": unknown})
+	}
+	return true, nil
+}
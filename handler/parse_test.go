@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type fuzzEmbedded struct {
+	Note string `json:"note"`
+}
+
+type fuzzInput struct {
+	fuzzEmbedded
+	Title   string     `json:"title"`
+	Count   *int       `json:"count"`
+	Tags    []string   `json:"tags"`
+	At      *time.Time `json:"at"`
+	Skipped string     `json:"-"`
+}
+
+func FuzzParseStrict(f *testing.F) {
+	f.Add([]byte(`{"title":"Lamp","count":2,"tags":["a"],"note":"x"}`))
+	f.Add([]byte(`{"TITLE":"case","Note":"embedded"}`))
+	f.Add([]byte(`{"title":"x","extra":true}`))
+	f.Add([]byte(`{"skipped":"hidden"}`))
+	f.Add([]byte(`{"count":"two"}`))
+	f.Add([]byte(`{"at":"not a time"}`))
+	f.Add([]byte(`[1,2]`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"title":"a"} {"title":"b"}`))
+	f.Add([]byte(``))
+
+	var ok bool
+	var got fuzzInput
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		got = fuzzInput{}
+		var err error
+		ok, err = parseStrict(c, &got)
+		if ok {
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+		return err
+	})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(fiber.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("rejected body %q answered %d", body, resp.StatusCode)
+			}
+			return
+		}
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("accepted body %q answered %d", body, resp.StatusCode)
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			t.Fatalf("accepted body %q is not a JSON object: %v", body, err)
+		}
+		if got.Skipped != "" {
+			t.Fatalf("body %q set a field tagged json:\"-\"", body)
+		}
+	})
+}
+
+func FuzzPaginate(f *testing.F) {
+	f.Add("1", "20")
+	f.Add("0", "0")
+	f.Add("-5", "1000")
+	f.Add("99999999999999999999", "abc")
+	f.Add("", "")
+
+	var page, perPage int
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		page, perPage = paginate(c)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	f.Fuzz(func(t *testing.T, p, pp string) {
+		q := url.Values{"page": {p}, "per_page": {pp}}
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/?"+q.Encode(), nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("page=%q per_page=%q answered %d", p, pp, resp.StatusCode)
+		}
+		if page < 1 || perPage < 1 || perPage > 100 {
+			t.Fatalf("page=%q per_page=%q gave page %d, per_page %d", p, pp, page, perPage)
+		}
+	})
+}
+
+func FuzzParamID(f *testing.F) {
+	f.Add("12")
+	f.Add("0")
+	f.Add("-1")
+	f.Add("'a'='b'OR'a'='a'")
+	f.Add("1 OR 1=1")
+	f.Add("18446744073709551616")
+
+	var id uint
+	var ok bool
+	app := fiber.New()
+	app.Get("/:id", func(c *fiber.Ctx) error {
+		id, ok = paramID(c, "id")
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	f.Fuzz(func(t *testing.T, param string) {
+		if param == "" {
+			return
+		}
+		id, ok = 0, false
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/"+url.PathEscape(param), nil), -1)
+		if err != nil || resp.StatusCode != fiber.StatusNoContent {
+			return
+		}
+		if ok && (id == 0 || strconv.FormatUint(uint64(id), 10) != strings.TrimLeft(param, "0")) {
+			t.Fatalf("param %q parsed as %d", param, id)
+		}
+	})
+}
@@ -1,55 +1,185 @@
 package handler
 
 import (
+	"app/audit"
+	"app/content"
+	"app/currency"
 	"app/database"
+	"app/events"
+	"app/middleware"
 	"app/model"
+	"app/validation"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
-// GetAllProducts query all products
+// ProductListTags cache tags of the product list
+func ProductListTags(c *fiber.Ctx) []string {
+	return []string{"products"}
+}
+
+// ProductTags cache tags of a single product
+func ProductTags(c *fiber.Ctx) []string {
+	return []string{"product:" + c.Params("id")}
+}
+
+// defaultCurrency currency of products created without one
+const defaultCurrency = "USD"
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// convertPrices set DisplayPrice on products for ?currency=<code>, leaving products in a currency
+// without a known rate unconverted. On failure the error response is already written.
+func convertPrices(c *fiber.Ctx, products ...*model.Product) (bool, error) {
+	to := strings.ToUpper(c.Query("currency"))
+	if to == "" {
+		return true, nil
+	}
+	rates, ok := currency.Current()
+	if !ok {
+		return false, c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "message": "Exchange rates are not available", "data": nil})
+	}
+	if !rates.Supports(to) {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Unsupported currency " + to, "data": nil})
+	}
+	for _, p := range products {
+		if rate, ok := rates.Rate(p.Currency, to); ok {
+			amount, _ := rates.Convert(float64(p.Amount), p.Currency, to)
+			p.DisplayPrice = &model.Price{Amount: amount, Currency: to, Rate: rate}
+		}
+	}
+	return true, nil
+}
+
+// GetAllProducts query all products, or with ?category=<id> those in that category and its subcategories.
+// attr.<key>=<value> parameters keep products whose attribute has that value.
 func GetAllProducts(c *fiber.Ctx) error {
-	db := database.DB
+	db := database.DB.WithContext(c.UserContext())
+	query := db.Model(&model.Product{}).Scopes(visibleProducts)
+	if id := c.Query("category"); id != "" {
+		cat, err := categoryByID(db, id)
+		if err != nil {
+			return categoryNotFound(c)
+		}
+		query = query.Where("category_id IN (?)", subtreeIDs(db, cat.Path))
+	}
+	query, bad := filterByAttributes(c, db, query)
+	if bad != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Unknown attribute " + bad, "data": nil})
+	}
 	var products []model.Product
-	db.Find(&products)
+	query.Find(&products)
+	converted := make([]*model.Product, len(products))
+	for i := range products {
+		converted[i] = &products[i]
+	}
+	if ok, err := convertPrices(c, converted...); !ok {
+		return err
+	}
+	translateProducts(c, converted...)
 	return c.JSON(fiber.Map{"status": "success", "message": "All products", "data": products})
 }
 
 // GetProduct query product
 func GetProduct(c *fiber.Ctx) error {
-	id := c.Params("id")
-	db := database.DB
-	var product model.Product
-	db.Find(&product, id)
-	if product.Title == "" {
+	product, err := productByID(c, c.Params("id"))
+	if err != nil || product.HiddenAt != nil {
 		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No product found with ID", "data": nil})
-
+	}
+	if ok, err := convertPrices(c, product); !ok {
+		return err
+	}
+	translateProducts(c, product)
+	if product.Locale != "" {
+		c.Set(fiber.HeaderContentLanguage, product.Locale)
 	}
 	return c.JSON(fiber.Map{"status": "success", "message": "Product found", "data": product})
 }
 
 // CreateProduct new product
 func CreateProduct(c *fiber.Ctx) error {
-	db := database.DB
-	product := new(model.Product)
-	if err := c.BodyParser(product); err != nil {
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create product", "data": err})
+	// NewProductInput fields a client may set; view counts, IDs and timestamps are the server's
+	type NewProductInput struct {
+		Title       string     `json:"title"`
+		Description string     `json:"description"`
+		Amount      int        `json:"amount"`
+		Currency    string     `json:"currency"`
+		CategoryID  *uint      `json:"category_id"`
+		Attributes  model.JSON `json:"attributes"`
+	}
+
+	input := new(NewProductInput)
+	if ok, err := parseStrict(c, input); !ok {
+		return err
 	}
-	db.Create(&product)
+	db := database.DB.WithContext(c.UserContext())
+	product := &model.Product{
+		Title:       validation.CleanLine(input.Title, 255),
+		Description: validation.CleanText(input.Description, 0),
+		Amount:      input.Amount,
+		Currency:    strings.ToUpper(strings.TrimSpace(input.Currency)),
+		CategoryID:  input.CategoryID,
+		Attributes:  input.Attributes,
+	}
+	if product.Currency == "" {
+		product.Currency = defaultCurrency
+	} else if !currencyPattern.MatchString(product.Currency) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "currency must be an ISO 4217 code such as USD", "data": nil})
+	}
+	html, err := content.RenderDescription(product.Description)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Couldn't render description", "errors": err.Error()})
+	}
+	product.DescriptionHTML = html
+	schema := map[string]model.CategoryAttribute{}
+	if product.CategoryID != nil {
+		var cat model.Category
+		if err := db.First(&cat, *product.CategoryID).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "No category found with ID", "data": nil})
+		}
+		if schema, err = categoryAttributes(db, &cat); err != nil {
+			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load attributes", "errors": err.Error()})
+		}
+	}
+	attributes, errs := checkAttributes(schema, product.Attributes)
+	if errs != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid attributes", "errors": errs})
+	}
+	product.Attributes = attributes
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := checkProductLimits(tx, middleware.CurrentUser(c)); err != nil {
+			return err
+		}
+		return tx.Create(&product).Error
+	})
+	var limitErr *productLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.respond(c)
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create product", "errors": err.Error()})
+	}
+	middleware.InvalidateCache("products")
+	events.Record(db, events.ProductCreated, "product", product.ID, tokenUserID(c), product)
 	return c.JSON(fiber.Map{"status": "success", "message": "Created product", "data": product})
 }
 
 // DeleteProduct delete product
 func DeleteProduct(c *fiber.Ctx) error {
-	id := c.Params("id")
-	db := database.DB
+	db := database.DB.WithContext(c.UserContext())
 
-	var product model.Product
-	db.First(&product, id)
-	if product.Title == "" {
+	product, err := productByID(c, c.Params("id"))
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No product found with ID", "data": nil})
-
 	}
-	db.Delete(&product)
+	db.Delete(product)
+	middleware.Forget(c, productMemoKey(product.ID))
+	middleware.InvalidateCache("products", "product:"+strconv.FormatUint(uint64(product.ID), 10))
+	events.Record(db, events.ProductDeleted, "product", product.ID, tokenUserID(c), product)
+	audit.Record(c, audit.Entry{Action: audit.ProductDeleted, Success: true, ActorID: tokenUserID(c), TargetType: "product", TargetID: audit.Target(product.ID)})
 	return c.JSON(fiber.Map{"status": "success", "message": "Product successfully deleted", "data": nil})
 }
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCreateProductRejectsServerFields(t *testing.T) {
+	app := fiber.New()
+	app.Post("/", CreateProduct)
+
+	for _, body := range []string{
+		`{"title":"Lamp","amount":10,"hidden_at":null}`,
+		`{"title":"Lamp","amount":10,"hidden_at":"2024-01-01T00:00:00Z"}`,
+		`{"title":"Lamp","amount":10,"view_count":1000000}`,
+		`{"title":"Lamp","amount":10,"ID":7}`,
+		`{"title":"Lamp","amount":10,"CreatedAt":"2020-01-01T00:00:00Z"}`,
+	} {
+		req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s answered %d, want 400", body, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"app/config"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Robots serve robots.txt from ROBOTS_TXT_PATH or a default that hides private routes
+func Robots(c *fiber.Ctx) error {
+	if path := config.Config("ROBOTS_TXT_PATH"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		c.Type("txt")
+		return c.Send(b)
+	}
+
+	base := strings.TrimRight(config.Config("APP_URL"), "/")
+	robots := "User-agent: *\n" +
+		"Allow: /api/product\n" +
+		"Disallow: /api/\n" +
+		"\n" +
+		"Sitemap: " + base + "/sitemap.xml\n"
+
+	c.Type("txt")
+	return c.SendString(robots)
+}
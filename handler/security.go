@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"app/clock"
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// securityReportRange default period of a security report
+	securityReportRange = 90 * 24 * time.Hour
+	// maxSecurityReportRange longest period a single report may cover
+	maxSecurityReportRange = 366 * 24 * time.Hour
+	maxSecurityReportRows  = 10000
+)
+
+// GetSecurityReport the caller's logins and security events between from and to (RFC 3339, default the
+// last 90 days), as a CSV download or, with ?format=json, a JSON list
+func GetSecurityReport(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	to := clock.Now()
+	if t, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+		to = t
+	}
+	from := to.Add(-securityReportRange)
+	if t, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+		from = t
+	}
+	if !from.Before(to) || to.Sub(from) > maxSecurityReportRange {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "from must be before to and at most 366 days earlier", "data": nil})
+	}
+
+	var logs []model.AuditLog
+	err := database.DB.
+		Where("(actor_id = ? OR (target_type = 'user' AND target_id = ?)) AND created_at >= ? AND created_at < ?", user.ID, user.ID, from, to).
+		Order("created_at desc").
+		Limit(maxSecurityReportRows).
+		Find(&logs).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't build security report", "errors": err.Error()})
+	}
+
+	if c.Query("format") == "json" {
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Security report",
+			"data":    logs,
+			"meta":    fiber.Map{"from": from, "to": to},
+		})
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"time", "action", "success", "ip", "user_agent", "request_id"})
+	for _, l := range logs {
+		w.Write([]string{l.CreatedAt.UTC().Format(time.RFC3339), l.Action, strconv.FormatBool(l.Success), l.IP, l.UserAgent, l.RequestID})
+	}
+	w.Flush()
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Attachment("security-report.csv")
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+// GetReadOnly report whether read-only mode is on
+func GetReadOnly(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "success", "message": "Read-only mode", "data": fiber.Map{"enabled": middleware.IsReadOnly()}})
+}
+
+// SetReadOnly toggle read-only mode for every instance
+func SetReadOnly(c *fiber.Ctx) error {
+	type ReadOnlyInput struct {
+		Enabled bool `json:"enabled"`
+	}
+	var input ReadOnlyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	setting := model.Setting{Key: middleware.ReadOnlySetting, Value: strconv.FormatBool(input.Enabled)}
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&setting).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update read-only mode", "errors": err.Error()})
+	}
+	middleware.SetReadOnly(input.Enabled)
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Read-only mode updated", "data": fiber.Map{"enabled": input.Enabled}})
+}
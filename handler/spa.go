@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// spaRoute report whether p is a client-side route: not under /api and not a file such as
+// a missing asset, which should 404 instead of answering with the page
+func spaRoute(p string) bool {
+	// routing is case-sensitive, so /API/ matches no route; it still gets the JSON 404
+	// rather than the page, since it's an API call with the wrong case, not a client route
+	p = strings.ToLower(p)
+	if p == "/api" || strings.HasPrefix(p, "/api/") {
+		return false
+	}
+	return path.Ext(p) == ""
+}
+
+// SPAFallback serve index.html for unmatched GET requests to client-side routes
+func SPAFallback(dir string) fiber.Handler {
+	index := filepath.Join(dir, "index.html")
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet || !spaRoute(c.Path()) {
+			return c.Next()
+		}
+		return c.SendFile(index)
+	}
+}
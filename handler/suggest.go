@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"app/database"
+	"app/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	suggestLimit    = 10
+	suggestCacheTTL = time.Minute
+	suggestCacheMax = 1000
+)
+
+type suggestEntry struct {
+	titles  []string
+	expires time.Time
+}
+
+var suggestCache = struct {
+	sync.Mutex
+	entries map[string]suggestEntry
+}{entries: map[string]suggestEntry{}}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SuggestProducts product titles starting with q, for typeahead inputs
+func SuggestProducts(c *fiber.Ctx) error {
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	if len([]rune(q)) < 2 || len(q) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "q must have between 2 and 100 characters", "data": nil})
+	}
+
+	suggestCache.Lock()
+	entry, ok := suggestCache.entries[q]
+	suggestCache.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return c.JSON(fiber.Map{"status": "success", "message": "Suggestions", "data": entry.titles})
+	}
+
+	db := database.DB.WithContext(c.UserContext())
+	titles := []string{}
+	// matches the lower(title) text_pattern_ops index
+	err := db.Model(&model.Product{}).
+		Scopes(visibleProducts).
+		Distinct("title").
+		Where("lower(title) LIKE ?", likeEscaper.Replace(q)+"%").
+		Order("title").
+		Limit(suggestLimit).
+		Pluck("title", &titles).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load suggestions", "errors": err.Error()})
+	}
+
+	suggestCache.Lock()
+	if len(suggestCache.entries) >= suggestCacheMax {
+		suggestCache.entries = map[string]suggestEntry{}
+	}
+	suggestCache.entries[q] = suggestEntry{titles: titles, expires: time.Now().Add(suggestCacheTTL)}
+	suggestCache.Unlock()
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Suggestions", "data": titles})
+}
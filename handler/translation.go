@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"app/content"
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"app/validation"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/text/language"
+	"gorm.io/gorm/clause"
+)
+
+// preferredLocales locales to try for the request's Accept-Language, best first. Each tag is
+// followed by its base language, so pt-BR falls back to pt before the next choice.
+func preferredLocales(c *fiber.Ctx) []string {
+	tags, _, err := language.ParseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage))
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var locales []string
+	for _, tag := range tags {
+		base, _ := tag.Base()
+		for _, l := range []string{tag.String(), base.String()} {
+			if !seen[l] && l != "und" {
+				seen[l] = true
+				locales = append(locales, l)
+			}
+		}
+	}
+	return locales
+}
+
+// translateProducts replace each product's title and description with the best translation for the
+// request's Accept-Language, keeping the original when none matches
+func translateProducts(c *fiber.Ctx, products ...*model.Product) {
+	locales := preferredLocales(c)
+	if len(locales) == 0 || len(products) == 0 {
+		return
+	}
+	ids := make([]uint, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	var translations []model.ProductTranslation
+	database.DB.WithContext(c.UserContext()).Where("product_id IN ? AND locale IN ?", ids, locales).Find(&translations)
+	if len(translations) == 0 {
+		return
+	}
+
+	byProduct := map[uint]map[string]model.ProductTranslation{}
+	for _, t := range translations {
+		if byProduct[t.ProductID] == nil {
+			byProduct[t.ProductID] = map[string]model.ProductTranslation{}
+		}
+		byProduct[t.ProductID][t.Locale] = t
+	}
+	for _, p := range products {
+		for _, l := range locales {
+			if t, ok := byProduct[p.ID][l]; ok {
+				p.Title, p.Description, p.DescriptionHTML, p.Locale = t.Title, t.Description, t.DescriptionHTML, t.Locale
+				break
+			}
+		}
+	}
+}
+
+// productTranslationTarget product in :id and canonical locale in :locale, writing the error
+// response and returning nil when the caller may not manage its translations
+func productTranslationTarget(c *fiber.Ctx) (*model.Product, string, error) {
+	product, err := productByID(c, c.Params("id"))
+	if err != nil {
+		return nil, "", c.Status(404).JSON(fiber.Map{"status": "error", "message": "No product found with ID", "data": nil})
+	}
+	user := middleware.CurrentUser(c)
+	if user.Role != model.RoleAdmin && (product.CreatedBy == nil || *product.CreatedBy != user.ID) {
+		return nil, "", c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "error", "message": "Only the product's owner can manage its translations", "data": nil})
+	}
+	tag, err := language.Parse(c.Params("locale"))
+	if err != nil {
+		return nil, "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "locale must be a language tag such as es or pt-BR", "data": nil})
+	}
+	return product, tag.String(), nil
+}
+
+// forgetProduct drop cached responses that show the product
+func forgetProduct(product *model.Product) {
+	middleware.InvalidateCache("products", "product:"+strconv.FormatUint(uint64(product.ID), 10))
+}
+
+// GetProductTranslations every translation of a product
+func GetProductTranslations(c *fiber.Ctx) error {
+	product, err := productByID(c, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No product found with ID", "data": nil})
+	}
+	translations := []model.ProductTranslation{}
+	database.DB.WithContext(c.UserContext()).Where("product_id = ?", product.ID).Order("locale").Find(&translations)
+	return c.JSON(fiber.Map{"status": "success", "message": "Product translations", "data": translations})
+}
+
+// PutProductTranslation create or replace the product's title and description in :locale
+func PutProductTranslation(c *fiber.Ctx) error {
+	type TranslationInput struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	var input TranslationInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	product, locale, err := productTranslationTarget(c)
+	if product == nil {
+		return err
+	}
+
+	t := model.ProductTranslation{
+		ProductID:   product.ID,
+		Locale:      locale,
+		Title:       validation.CleanLine(input.Title, 255),
+		Description: validation.CleanText(input.Description, 0),
+	}
+	if t.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "title is required", "data": nil})
+	}
+	if t.DescriptionHTML, err = content.RenderDescription(t.Description); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Couldn't render description", "errors": err.Error()})
+	}
+	err = database.DB.WithContext(c.UserContext()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "description", "description_html", "updated_at"}),
+	}).Create(&t).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't save translation", "errors": err.Error()})
+	}
+	forgetProduct(product)
+	return c.JSON(fiber.Map{"status": "success", "message": "Translation saved", "data": t})
+}
+
+// DeleteProductTranslation remove the product's translation in :locale
+func DeleteProductTranslation(c *fiber.Ctx) error {
+	product, locale, err := productTranslationTarget(c)
+	if product == nil {
+		return err
+	}
+	res := database.DB.WithContext(c.UserContext()).Where("product_id = ? AND locale = ?", product.ID, locale).Delete(&model.ProductTranslation{})
+	if res.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't delete translation", "errors": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No translation for this locale", "data": nil})
+	}
+	forgetProduct(product)
+	return c.JSON(fiber.Map{"status": "success", "message": "Translation deleted", "data": nil})
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"app/config"
+	"app/database"
+	"app/model"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	trendingSize     = 100
+	trendingCacheTTL = time.Minute
+)
+
+var trendingCache = struct {
+	sync.Mutex
+	products []model.Product
+	expires  time.Time
+}{}
+
+func durationConfig(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(config.Config(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+func floatConfig(key string, fallback float64) float64 {
+	f, err := strconv.ParseFloat(config.Config(key), 64)
+	if err != nil || f < 0 {
+		return fallback
+	}
+	return f
+}
+
+// ComputeTrending score products by views within TRENDING_WINDOW, each view weighted by
+// TRENDING_VIEW_WEIGHT and halved every TRENDING_HALF_LIFE, and store the top scores
+func ComputeTrending(ctx context.Context) error {
+	window := durationConfig("TRENDING_WINDOW", 7*24*time.Hour)
+	halfLife := durationConfig("TRENDING_HALF_LIFE", 24*time.Hour)
+	viewWeight := floatConfig("TRENDING_VIEW_WEIGHT", 1)
+	now := time.Now()
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM trending_products").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO trending_products (product_id, score, computed_at)
+			SELECT product_id, SUM(? * exp(-ln(2) * extract(epoch FROM (? - created_at)) / ?)) AS score, ?
+			FROM product_views
+			WHERE created_at > ?
+			GROUP BY product_id
+			ORDER BY score DESC
+			LIMIT ?`,
+			viewWeight, now, halfLife.Seconds(), now, now.Add(-window), trendingSize,
+		).Error
+	})
+}
+
+// GetTrendingProducts most popular products from the last trending computation
+func GetTrendingProducts(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > trendingSize {
+		limit = 20
+	}
+
+	trendingCache.Lock()
+	defer trendingCache.Unlock()
+	if time.Now().After(trendingCache.expires) {
+		var products []model.Product
+		err := database.DB.
+			Joins("JOIN trending_products ON trending_products.product_id = products.id").
+			Scopes(visibleProducts).
+			Order("trending_products.score DESC").
+			Limit(trendingSize).
+			Find(&products).Error
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load trending products", "errors": err.Error()})
+		}
+		trendingCache.products = products
+		trendingCache.expires = time.Now().Add(trendingCacheTTL)
+	}
+
+	products := trendingCache.products
+	if len(products) > limit {
+		products = products[:limit]
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Trending products", "data": products})
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"app/audit"
+	"app/clock"
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"app/random"
+	"app/scanner"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxUploadPartSize largest part, within the default request body limit
+	maxUploadPartSize = 4 << 20
+	maxUploadSize     = 64 << 20
+	maxUploadParts    = 1000
+	// uploadTTL how long an upload can be resumed, and kept once completed
+	uploadTTL = 24 * time.Hour
+)
+
+var fileScanner = scanner.New()
+
+// PartDigestHeader request header carrying the hex SHA-256 of an uploaded part
+const PartDigestHeader = "X-Part-SHA256"
+
+// uploadByID upload owned by the caller
+func uploadByID(c *fiber.Ctx, id string) (*model.Upload, error) {
+	var upload model.Upload
+	err := database.DB.Omit("data").
+		Where("id = ? AND user_id = ? AND expires_at > ?", id, middleware.CurrentUser(c).ID, clock.Now()).
+		First(&upload).Error
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func uploadNotFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No upload found with ID", "data": nil})
+}
+
+func validDigest(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// CreateUpload start a resumable upload of a file with a known size and SHA-256
+func CreateUpload(c *fiber.Ctx) error {
+	type UploadInput struct {
+		Filename string `json:"filename"`
+		Size     int64  `json:"size"`
+		SHA256   string `json:"sha256"`
+	}
+	var input UploadInput
+	if ok, err := parseStrict(c, &input); !ok {
+		return err
+	}
+	input.SHA256 = strings.ToLower(input.SHA256)
+	if input.Filename == "" || input.Size < 1 || input.Size > maxUploadSize || !validDigest(input.SHA256) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("filename, size (1 to %d bytes) and a hex sha256 are required", maxUploadSize), "data": nil})
+	}
+
+	id, err := random.Hex(16)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	upload := model.Upload{
+		ID:        id,
+		ExpiresAt: clock.Now().Add(uploadTTL),
+		UserID:    middleware.CurrentUser(c).ID,
+		Filename:  input.Filename,
+		Size:      input.Size,
+		SHA256:    input.SHA256,
+		Status:    model.UploadPending,
+	}
+	if err := database.DB.WithContext(c.UserContext()).Create(&upload).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't start upload", "errors": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "Upload started", "data": upload,
+		"meta": fiber.Map{"max_part_size": maxUploadPartSize}})
+}
+
+// GetUpload an upload with the parts received so far, so a client can resume with the missing ones
+func GetUpload(c *fiber.Ctx) error {
+	upload, err := uploadByID(c, c.Params("id"))
+	if err != nil {
+		return uploadNotFound(c)
+	}
+	var parts []model.UploadPart
+	database.DB.Omit("data").Where("upload_id = ?", upload.ID).Order("number").Find(&parts)
+	return c.JSON(fiber.Map{"status": "success", "message": "Upload found", "data": fiber.Map{"upload": upload, "parts": parts}})
+}
+
+// PutUploadPart store part :number of an upload from the raw body, checked against X-Part-SHA256
+func PutUploadPart(c *fiber.Ctx) error {
+	upload, err := uploadByID(c, c.Params("id"))
+	if err != nil {
+		return uploadNotFound(c)
+	}
+	if upload.Status != model.UploadPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "message": "Upload no longer accepts parts", "data": nil})
+	}
+	number, err := c.ParamsInt("number")
+	if err != nil || number < 1 || number > maxUploadParts {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("Part number must be 1-%d", maxUploadParts), "data": nil})
+	}
+	body := c.Body()
+	if len(body) == 0 || len(body) > maxUploadPartSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("Parts must be 1 to %d bytes", maxUploadPartSize), "data": nil})
+	}
+
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	if want := strings.ToLower(c.Get(PartDigestHeader)); want != "" && want != digest {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "error", "code": "DIGEST_MISMATCH", "message": "Part does not match its X-Part-SHA256", "data": nil})
+	}
+
+	part := model.UploadPart{UploadID: upload.ID, Number: number, Size: len(body), SHA256: digest, Data: append([]byte(nil), body...)}
+	if err := database.DB.WithContext(c.UserContext()).Clauses(clause.OnConflict{UpdateAll: true}).Create(&part).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't store part", "errors": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Part stored", "data": part})
+}
+
+// CompleteUpload assemble the parts in order and check the result against the declared size and SHA-256
+func CompleteUpload(c *fiber.Ctx) error {
+	upload, err := uploadByID(c, c.Params("id"))
+	if err != nil {
+		return uploadNotFound(c)
+	}
+	switch upload.Status {
+	case model.UploadComplete:
+		return c.JSON(fiber.Map{"status": "success", "message": "Upload complete", "data": upload})
+	case model.UploadQuarantined:
+		return uploadQuarantined(c, upload)
+	}
+
+	var parts []model.UploadPart
+	if err := database.DB.WithContext(c.UserContext()).Where("upload_id = ?", upload.ID).Order("number").Find(&parts).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load parts", "errors": err.Error()})
+	}
+	data := make([]byte, 0, upload.Size)
+	for i, p := range parts {
+		if p.Number != i+1 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "error", "code": "MISSING_PARTS", "message": fmt.Sprintf("Part %d is missing", i+1), "data": nil})
+		}
+		data = append(data, p.Data...)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != upload.Size || hex.EncodeToString(sum[:]) != upload.SHA256 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "error", "code": "DIGEST_MISMATCH", "message": "Assembled file does not match the declared size and sha256", "data": fiber.Map{"received": len(data)}})
+	}
+
+	result, err := fileScanner.Scan(c.UserContext(), data)
+	upload.Status, upload.ScanStatus = model.UploadComplete, model.ScanClean
+	switch {
+	case errors.Is(err, scanner.ErrDisabled):
+		upload.ScanStatus = model.ScanSkipped
+	case err != nil:
+		log.Printf("failed to scan upload %s: %v", upload.ID, err)
+		database.DB.WithContext(c.UserContext()).Model(&model.Upload{}).Where("id = ?", upload.ID).Update("scan_status", model.ScanFailed)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "error", "code": "SCAN_FAILED", "message": "Couldn't scan the file, complete the upload again later", "data": nil})
+	case result.Infected:
+		upload.Status, upload.ScanStatus, upload.ScanSignature = model.UploadQuarantined, model.ScanInfected, result.Signature
+	}
+	now := clock.Now()
+	upload.ScannedAt = &now
+
+	err = database.DB.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Upload{}).Where("id = ?", upload.ID).Updates(map[string]interface{}{
+			"status":         upload.Status,
+			"data":           data,
+			"scan_status":    upload.ScanStatus,
+			"scan_signature": upload.ScanSignature,
+			"scanned_at":     upload.ScannedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("upload_id = ?", upload.ID).Delete(&model.UploadPart{}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't complete upload", "errors": err.Error()})
+	}
+	if upload.Status == model.UploadQuarantined {
+		log.Printf("quarantined upload %s of user %d: %s", upload.ID, upload.UserID, upload.ScanSignature)
+		audit.Record(c, audit.Entry{Action: audit.UploadQuarantined, Success: true, ActorID: &upload.UserID, TargetType: "user", TargetID: audit.Target(upload.UserID),
+			Details: map[string]interface{}{"upload_id": upload.ID, "filename": upload.Filename, "signature": upload.ScanSignature}})
+		return uploadQuarantined(c, upload)
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Upload complete", "data": upload})
+}
+
+func uploadQuarantined(c *fiber.Ctx, upload *model.Upload) error {
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "error", "code": "MALWARE_DETECTED", "message": "Malware was found in the file, it has been quarantined", "data": upload})
+}
+
+// AbortUpload discard an upload and its parts
+func AbortUpload(c *fiber.Ctx) error {
+	upload, err := uploadByID(c, c.Params("id"))
+	if err != nil {
+		return uploadNotFound(c)
+	}
+	if err := deleteUploads(database.DB, "id = ?", upload.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't abort upload", "errors": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "success", "message": "Upload aborted", "data": nil})
+}
+
+// completedUpload contents of the caller's completed upload id
+func completedUpload(c *fiber.Ctx, id string) ([]byte, error) {
+	var upload model.Upload
+	err := database.DB.
+		Where("id = ? AND user_id = ? AND status = ? AND expires_at > ?", id, middleware.CurrentUser(c).ID, model.UploadComplete, clock.Now()).
+		First(&upload).Error
+	return upload.Data, err
+}
+
+// deleteUploads delete the uploads matching query and their parts
+func deleteUploads(db *gorm.DB, query string, args ...interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		ids := tx.Model(&model.Upload{}).Select("id").Where(query, args...)
+		if err := tx.Where("upload_id IN (?)", ids).Delete(&model.UploadPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Where(query, args...).Delete(&model.Upload{}).Error
+	})
+}
+
+// PurgeUploads delete uploads that can no longer be resumed or used
+func PurgeUploads(ctx context.Context) error {
+	return deleteUploads(database.DB.WithContext(ctx), "expires_at < ?", clock.Now())
+}
@@ -1,84 +1,166 @@
 package handler
 
 import (
+	"app/audit"
 	"app/database"
+	"app/events"
+	"app/middleware"
 	"app/model"
+	"app/validation"
+	"fmt"
+	"log"
 	"strconv"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// maxNamesLength longest display name kept, in characters
+const maxNamesLength = 255
+
+// minBcryptCost lowest bcrypt cost accepted from BCRYPT_COST
+const minBcryptCost = 10
+
+var bcryptCost = 14
+
+// SetBcryptCost set the cost of newly hashed passwords, between 10 and bcrypt.MaxCost
+func SetBcryptCost(cost int) error {
+	if cost < minBcryptCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be %d-%d, got %d", minBcryptCost, bcrypt.MaxCost, cost)
+	}
+	bcryptCost = cost
+	return nil
+}
+
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	return string(bytes), err
 }
 
-func validToken(t *jwt.Token, id string) bool {
-	n, err := strconv.Atoi(id)
+// needsRehash report whether hash was created at a lower cost than the current one
+func needsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < bcryptCost
+}
+
+// tokenUserID user ID of the request's JWT, nil for anonymous requests
+func tokenUserID(c *fiber.Ctx) *uint {
+	auth, err := middleware.Claims(c)
 	if err != nil {
-		return false
+		return nil
 	}
-
-	claims := t.Claims.(jwt.MapClaims)
-	uid := int(claims["user_id"].(float64))
-
-	return uid == n
+	id := auth.UserID
+	return &id
 }
 
-func validUser(id string, p string) bool {
-	db := database.DB
-	var user model.User
-	db.First(&user, id)
-	if user.Username == "" {
-		return false
-	}
-	if !CheckPasswordHash(p, user.Password) {
+// validToken report whether the request's token belongs to the user with id
+func validToken(c *fiber.Ctx, id string) bool {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
 		return false
 	}
-	return true
+	auth, err := middleware.Claims(c)
+	return err == nil && uint64(auth.UserID) == n
+}
+
+// publicUser fields of a user anyone may see, keyed like the full user's JSON
+type publicUser struct {
+	ID        uint      `json:"ID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	Username  string    `json:"username"`
+	Names     string    `json:"names"`
 }
 
-// GetUser get a user
+// GetUser get a user's public profile
 func GetUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	db := database.DB
-	var user model.User
-	db.Find(&user, id)
-	if user.Username == "" {
+	user, err := userByID(c, c.Params("id"))
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
 	}
-	return c.JSON(fiber.Map{"status": "success", "message": "User found", "data": user})
+	profile := publicUser{ID: user.ID, CreatedAt: user.CreatedAt, Username: user.Username, Names: user.Names}
+	return c.JSON(fiber.Map{"status": "success", "message": "User found", "data": profile})
 }
 
-// CreateUser new user
-func CreateUser(c *fiber.Ctx) error {
-	type NewUser struct {
+// GetCurrentUser the user the request's token belongs to, so clients don't need to know their own ID
+func GetCurrentUser(c *fiber.Ctx) error {
+	// a copy, so blanking the password leaves the user in c.Locals intact for the rest of the request
+	me := *middleware.CurrentUser(c)
+	me.Password = ""
+	return c.JSON(fiber.Map{"status": "success", "message": "User found", "data": me})
+}
+
+// registerUser parse, validate and store the user described by the request body.
+// On failure the error response is already written and the returned user is nil.
+func registerUser(c *fiber.Ctx) (*model.User, error) {
+	type NewUserInput struct {
 		Username string `json:"username"`
 		Email    string `json:"email"`
+		Password string `json:"password"`
+		Names    string `json:"names"`
 	}
 
-	db := database.DB
-	user := new(model.User)
-	if err := c.BodyParser(user); err != nil {
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
+	db := database.DB.WithContext(c.UserContext())
+	input := new(NewUserInput)
+	if ok, err := parseStrict(c, input); !ok {
+		return nil, err
+	}
+	user := &model.User{
+		Username: validation.CleanLine(input.Username, 0),
+		Email:    input.Email,
+		Password: input.Password,
+		Names:    validation.CleanLine(input.Names, maxNamesLength),
 	}
 
-	validate := validator.New()
-	if err := validate.Struct(user); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body", "errors": err.Error()})
+	if errs := validation.Struct(user, c.AcceptsLanguages(validation.Locales...)); errs != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": errs})
+	}
+
+	// a restorable deleted account with this email is only mentioned to the mailbox owner, so the
+	// response doesn't tell anyone whether an email was ever registered
+	var deleted int64
+	err := db.Unscoped().Model(&model.User{}).
+		Where("lower(email) = lower(?) AND deleted_at IS NOT NULL AND password <> ''", user.Email).
+		Count(&deleted).Error
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create user", "errors": err.Error()})
 	}
 
 	hash, err := hashPassword(user.Password)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "errors": err.Error()})
+		return nil, c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "errors": err.Error()})
 	}
 
 	user.Password = hash
 	if err := db.Create(&user).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create user", "errors": err.Error()})
+		return nil, c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create user", "errors": err.Error()})
+	}
+	events.Record(db, events.UserCreated, "user", user.ID, &user.ID, events.UserSnapshot(user))
+	if deleted > 0 {
+		notifyEmail(c.UserContext(), user.Email, "You created a new account",
+			fmt.Sprintf("A new account, %s, was created with this address. An earlier account that used it was deleted and "+
+				"can't be restored while the address is in use. If you wanted it back instead, delete the new account and "+
+				"contact support to restore the old one.\n", user.Username))
+	}
+	if err := linkIdentity(db, user.ID, model.ProviderPassword, strconv.FormatUint(uint64(user.ID), 10)); err != nil {
+		log.Printf("failed to link password identity of user %d: %v", user.ID, err)
+	}
+	if err := mergeGuest(c, user); err != nil {
+		log.Printf("failed to merge guest into user %d: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+// CreateUser new user
+func CreateUser(c *fiber.Ctx) error {
+	type NewUser struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+
+	user, err := registerUser(c)
+	if user == nil {
+		return err
 	}
 
 	newUser := NewUser{
@@ -92,26 +174,40 @@ func CreateUser(c *fiber.Ctx) error {
 // UpdateUser update user
 func UpdateUser(c *fiber.Ctx) error {
 	type UpdateUserInput struct {
-		Names string `json:"names"`
+		Names            *string `json:"names"`
+		AnalyticsConsent *bool   `json:"analytics_consent"`
 	}
 	var uui UpdateUserInput
 	if err := c.BodyParser(&uui); err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
 	}
 	id := c.Params("id")
-	token := c.Locals("user").(*jwt.Token)
-
-	if !validToken(token, id) {
+	if !validToken(c, id) {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Invalid token id", "data": nil})
 	}
 
-	db := database.DB
-	var user model.User
+	db := database.DB.WithContext(c.UserContext())
 
-	db.First(&user, id)
-	user.Names = uui.Names
-	db.Save(&user)
+	// only the edited columns are written: the loaded user may be up to userCacheTTL stale, and saving
+	// it whole could undo a suspension, forced logout or role change made in the meantime
+	changes := map[string]interface{}{}
+	if uui.Names != nil {
+		changes["names"] = validation.CleanLine(*uui.Names, maxNamesLength)
+	}
+	if uui.AnalyticsConsent != nil {
+		changes["analytics_consent"] = *uui.AnalyticsConsent
+	}
+	if len(changes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Send names or analytics_consent", "data": nil})
+	}
+	user := *middleware.CurrentUser(c)
+	if err := db.Model(&user).Updates(changes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update user", "errors": err.Error()})
+	}
+	middleware.ForgetUser(user.ID)
+	events.Record(db, events.UserUpdated, "user", user.ID, &user.ID, events.UserSnapshot(&user))
 
+	user.Password = ""
 	return c.JSON(fiber.Map{"status": "success", "message": "User successfully updated", "data": user})
 }
 
@@ -121,27 +217,25 @@ func DeleteUser(c *fiber.Ctx) error {
 		Password string `json:"password"`
 	}
 	var pi PasswordInput
-	if err := c.BodyParser(&pi); err != nil {
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Review your input", "errors": err.Error()})
+	if ok, err := parseStrict(c, &pi); !ok {
+		return err
 	}
 	id := c.Params("id")
-	token := c.Locals("user").(*jwt.Token)
-
-	if !validToken(token, id) {
+	if !validToken(c, id) {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Invalid token id", "data": nil})
 
 	}
 
-	if !validUser(id, pi.Password) {
+	user := middleware.CurrentUser(c)
+	if !CheckPasswordHash(pi.Password, user.Password) {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Not valid user", "data": nil})
 
 	}
 
-	db := database.DB
-	var user model.User
-
-	db.First(&user, id)
-
-	db.Delete(&user)
+	db := database.DB.WithContext(c.UserContext())
+	db.Delete(user)
+	middleware.ForgetUser(user.ID)
+	events.Record(db, events.UserDeleted, "user", user.ID, &user.ID, events.UserSnapshot(user))
+	audit.Record(c, audit.Entry{Action: audit.UserDeleted, Success: true, ActorID: &user.ID, TargetType: "user", TargetID: audit.Target(user.ID)})
 	return c.JSON(fiber.Map{"status": "success", "message": "User successfully deleted", "data": nil})
 }
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"app/database"
+	"app/middleware"
+	"app/model"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	viewDedupeWindow  = 10 * time.Minute
+	recentlyViewedMax = 20
+)
+
+var pendingViews = struct {
+	sync.Mutex
+	counts map[uint]int64
+}{counts: map[uint]int64{}}
+
+// FlushViewCounts add buffered views to each product's view_count
+func FlushViewCounts() {
+	pendingViews.Lock()
+	counts := pendingViews.counts
+	pendingViews.counts = map[uint]int64{}
+	pendingViews.Unlock()
+
+	db := database.DB
+	for id, n := range counts {
+		if err := db.Model(&model.Product{}).Where("id = ?", id).
+			UpdateColumn("view_count", gorm.Expr("view_count + ?", n)).Error; err != nil {
+			log.Printf("failed to update view count of product %d: %v", id, err)
+		}
+	}
+}
+
+// StartViewCountFlusher write buffered view counts every 30 seconds
+func StartViewCountFlusher() {
+	go func() {
+		for range time.Tick(30 * time.Second) {
+			FlushViewCounts()
+		}
+	}()
+}
+
+// ViewProduct record that the caller viewed a product, ignoring repeats within ten minutes
+func ViewProduct(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+
+	product, err := productByID(c, c.Params("id"))
+	if err != nil || product.HiddenAt != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No product found with ID", "data": nil})
+	}
+
+	var recent int64
+	db.Model(&model.ProductView{}).
+		Where("user_id = ? AND product_id = ? AND created_at > ?", user.ID, product.ID, time.Now().Add(-viewDedupeWindow)).
+		Count(&recent)
+	if recent > 0 {
+		return c.JSON(fiber.Map{"status": "success", "message": "View already recorded", "data": nil})
+	}
+
+	if err := db.Create(&model.ProductView{UserID: user.ID, ProductID: product.ID}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't record view", "errors": err.Error()})
+	}
+	pendingViews.Lock()
+	pendingViews.counts[product.ID]++
+	pendingViews.Unlock()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "message": "View recorded", "data": nil})
+}
+
+// GetRecentlyViewed products the caller viewed most recently
+func GetRecentlyViewed(c *fiber.Ctx) error {
+	db := database.DB.WithContext(c.UserContext())
+	user := middleware.CurrentUser(c)
+
+	var ids []uint
+	err := db.Model(&model.ProductView{}).
+		Select("product_id").
+		Where("user_id = ?", user.ID).
+		Group("product_id").
+		Order("MAX(created_at) DESC").
+		Limit(recentlyViewedMax).
+		Pluck("product_id", &ids).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't load recently viewed products", "errors": err.Error()})
+	}
+
+	var found []model.Product
+	if len(ids) > 0 {
+		db.Scopes(visibleProducts).Find(&found, ids)
+	}
+	byID := make(map[uint]model.Product, len(found))
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	products := make([]model.Product, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			products = append(products, p)
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Recently viewed products", "data": products})
+}
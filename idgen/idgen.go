@@ -0,0 +1,59 @@
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDs are 63 bits: milliseconds since epoch, then the worker, then a per-millisecond sequence,
+// so they sort by creation time and never collide between workers
+const (
+	workerBits   = 10
+	sequenceBits = 12
+	sequenceMask = 1<<sequenceBits - 1
+
+	// MaxWorker largest worker ID
+	MaxWorker = 1<<workerBits - 1
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var gen struct {
+	sync.Mutex
+	worker int64
+	last   int64
+	seq    int64
+}
+
+// SetWorker set the worker ID embedded in every ID this process generates
+func SetWorker(id int64) error {
+	if id < 0 || id > MaxWorker {
+		return fmt.Errorf("worker ID %d outside 0-%d", id, MaxWorker)
+	}
+	gen.Lock()
+	gen.worker = id
+	gen.Unlock()
+	return nil
+}
+
+// Next unique, time-ordered ID
+func Next() int64 {
+	gen.Lock()
+	defer gen.Unlock()
+
+	now := time.Since(epoch).Milliseconds()
+	if now <= gen.last {
+		// same millisecond, or the clock stepped back: keep counting from the last one
+		now = gen.last
+		gen.seq = (gen.seq + 1) & sequenceMask
+		if gen.seq == 0 {
+			now++
+		}
+	} else {
+		gen.seq = 0
+	}
+	gen.last = now
+
+	return now<<(workerBits+sequenceBits) | gen.worker<<sequenceBits | gen.seq
+}
@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"app/clock"
+	"app/database"
+	"app/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxRuntime longest a job may run before its context is cancelled
+const maxRuntime = time.Hour
+
+// staleAfter running jobs not updated for this long are assumed lost with their process;
+// jobs keep themselves fresh by reporting progress
+const staleAfter = 10 * time.Minute
+
+// Result output of a finished job, downloadable from its result link
+type Result struct {
+	Body        []byte
+	ContentType string
+	Filename    string
+}
+
+// Reporter records a running job's progress and errors
+type Reporter struct {
+	id     uint
+	mu     sync.Mutex
+	saved  time.Time
+	errors []string
+}
+
+// Progress record that done of total units are finished, writing at most once a second
+func (r *Reporter) Progress(done, total int) {
+	if total <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if done < total && clock.Since(r.saved) < time.Second {
+		return
+	}
+	r.saved = clock.Now()
+	database.DB.Model(&model.Job{}).Where("id = ?", r.id).UpdateColumns(map[string]interface{}{
+		"progress":   done * 100 / total,
+		"updated_at": r.saved,
+	})
+}
+
+// JobID ID of the job being reported on
+func (r *Reporter) JobID() uint {
+	return r.id
+}
+
+// Error add a non-fatal error to the job's error list
+func (r *Reporter) Error(msg string) {
+	r.mu.Lock()
+	r.errors = append(r.errors, msg)
+	r.mu.Unlock()
+}
+
+// Func work done by a job
+type Func func(ctx context.Context, r *Reporter) (*Result, error)
+
+// Start queue fn as a job of typ owned by userID and run it in the background on this instance
+func Start(userID uint, typ string, fn Func) (*model.Job, error) {
+	job := &model.Job{UserID: userID, Type: typ, Status: model.JobQueued}
+	if err := database.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+	go run(job.ID, fn)
+	return job, nil
+}
+
+func run(id uint, fn Func) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxRuntime)
+	defer cancel()
+	database.DB.Model(&model.Job{}).Where("id = ?", id).Update("status", model.JobRunning)
+
+	r := &Reporter{id: id}
+	result, err := safeRun(ctx, r, fn)
+
+	now := clock.Now()
+	update := map[string]interface{}{"status": model.JobSucceeded, "progress": 100, "finished_at": &now}
+	if err != nil {
+		log.Printf("job %d failed: %v", id, err)
+		update["status"] = model.JobFailed
+		r.Error(err.Error())
+	} else if result != nil {
+		update["result"] = result.Body
+		update["result_type"] = result.ContentType
+		update["result_name"] = result.Filename
+	}
+	if len(r.errors) > 0 {
+		if b, err := json.Marshal(r.errors); err == nil {
+			update["errors"] = model.JSON(b)
+		}
+	}
+	if err := database.DB.Model(&model.Job{}).Where("id = ?", id).Updates(update).Error; err != nil {
+		log.Printf("failed to save outcome of job %d: %v", id, err)
+	}
+}
+
+// safeRun run fn, turning a panic into the job's error
+func safeRun(ctx context.Context, r *Reporter, fn Func) (result *Result, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return fn(ctx, r)
+}
+
+// FailStale mark running jobs whose process stopped reporting as failed
+func FailStale(ctx context.Context) error {
+	errs, _ := json.Marshal([]string{"job was interrupted"})
+	now := clock.Now()
+	return database.DB.WithContext(ctx).Model(&model.Job{}).
+		Where("status IN ? AND updated_at < ?", []string{model.JobQueued, model.JobRunning}, now.Add(-staleAfter)).
+		Updates(map[string]interface{}{"status": model.JobFailed, "errors": model.JSON(errs), "finished_at": &now}).Error
+}
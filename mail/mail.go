@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"app/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrDisabled returned by the disabled sender when MAIL_PROVIDER is unset
+var ErrDisabled = errors.New("email is not configured")
+
+// Sender delivers plain-text emails
+type Sender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// New sender chosen by MAIL_PROVIDER: smtp, or log to print messages during development.
+// Unset, every send fails with ErrDisabled.
+func New() Sender {
+	switch config.Config("MAIL_PROVIDER") {
+	case "smtp":
+		port := config.Config("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTP{
+			Addr:     net.JoinHostPort(config.Config("SMTP_HOST"), port),
+			Username: config.Config("SMTP_USERNAME"),
+			Password: config.Config("SMTP_PASSWORD"),
+			From:     config.Config("MAIL_FROM"),
+		}
+	case "log":
+		return logSender{}
+	}
+	return disabled{}
+}
+
+type disabled struct{}
+
+func (disabled) Send(context.Context, string, string, string) error { return ErrDisabled }
+
+type logSender struct{}
+
+func (logSender) Send(_ context.Context, to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// SMTP sends through a mail server, authenticating with PLAIN when a username is set
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Sender
+func (s *SMTP) Send(_ context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid header value")
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to}, []byte(msg))
+}
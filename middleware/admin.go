@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"app/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminOnly allow only admins, must run after LoadUser
+func AdminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := CurrentUser(c)
+		if user == nil || user.Role != model.RoleAdmin {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Admin access required", "data": nil})
+		}
+		return c.Next()
+	}
+}
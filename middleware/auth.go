@@ -1,25 +1,117 @@
 package middleware
 
 import (
+	"app/clock"
 	"app/config"
+	"app/database"
+	"app/model"
+	"context"
+	"errors"
+	"strings"
+	"time"
 
-	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-// Protected protect routes
+var errMissingToken = errors.New("Missing or malformed JWT")
+
+// jwtLeeway clock skew tolerated on exp and iat, from JWT_LEEWAY (default 0)
+func jwtLeeway() time.Duration {
+	d, err := time.ParseDuration(config.Config("JWT_LEEWAY"))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// bearerToken token of an "Authorization: Bearer <token>" header, empty when there is none
+func bearerToken(c *fiber.Ctx) string {
+	const scheme = "Bearer"
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) > len(scheme)+1 && strings.EqualFold(auth[:len(scheme)], scheme) {
+		return strings.TrimSpace(auth[len(scheme):])
+	}
+	return ""
+}
+
+// Protected protect routes, accepting a Bearer token or, in cookie auth mode, the access token cookie.
+// exp and iat are checked against the installed clock with JWT_LEEWAY of tolerance.
 func Protected() fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		SigningKey:   jwtware.SigningKey{Key: []byte(config.Config("SECRET"))},
-		ErrorHandler: jwtError,
-	})
+	return protected(false)
+}
+
+// OptionalAuth verify the request's token like Protected, but let requests without a valid one through anonymously
+func OptionalAuth() fiber.Handler {
+	return protected(true)
+}
+
+func protected(optional bool) fiber.Handler {
+	secret := []byte(config.Config("SECRET"))
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithLeeway(jwtLeeway()),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(clock.Now),
+	)
+	keyFunc := func(*jwt.Token) (interface{}, error) { return secret, nil }
+	cookie := CookieAuth()
+
+	return func(c *fiber.Ctx) error {
+		raw := bearerToken(c)
+		if raw == "" && cookie {
+			raw = c.Cookies(AccessTokenCookie)
+		}
+		if raw == "" {
+			if optional {
+				return c.Next()
+			}
+			return jwtError(c, errMissingToken)
+		}
+		token, err := parser.Parse(raw, keyFunc)
+		if err != nil {
+			if optional {
+				return c.Next()
+			}
+			return jwtError(c, err)
+		}
+		c.Locals("user", token)
+		return checkToken(c)
+	}
 }
 
 func jwtError(c *fiber.Ctx, err error) error {
-	if err.Error() == "Missing or malformed JWT" {
+	if errors.Is(err, errMissingToken) {
 		return c.Status(fiber.StatusBadRequest).
 			JSON(fiber.Map{"status": "error", "message": "Missing or malformed JWT", "data": nil})
 	}
 	return c.Status(fiber.StatusUnauthorized).
 		JSON(fiber.Map{"status": "error", "message": "Invalid or expired JWT", "data": nil})
 }
+
+// checkToken parse the claims once and reject tokens whose jti was revoked by a logout
+func checkToken(c *fiber.Ctx) error {
+	auth, err := Claims(c)
+	if err != nil {
+		return jwtError(c, err)
+	}
+	if auth.TokenID == "" {
+		return c.Next()
+	}
+
+	var revoked int64
+	if err := database.DB.Model(&model.RevokedToken{}).Where("jti = ?", auth.TokenID).Count(&revoked).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Couldn't check token", "errors": err.Error()})
+	}
+	if revoked > 0 {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(fiber.Map{"status": "error", "message": "Invalid or expired JWT", "data": nil})
+	}
+	return c.Next()
+}
+
+// PurgeRevokedTokens forget revoked tokens that have expired on their own
+func PurgeRevokedTokens(ctx context.Context) error {
+	return database.DB.WithContext(ctx).Where("expires_at < ?", clock.Now()).Delete(&model.RevokedToken{}).Error
+}
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"app/config"
+	"app/database"
+	"app/model"
+	"expvar"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxCachedResponses = 1000
+	cacheTagRefresh    = 2 * time.Second
+)
+
+var (
+	cacheHits   = expvar.NewInt("response_cache_hits")
+	cacheStale  = expvar.NewInt("response_cache_stale_hits")
+	cacheMisses = expvar.NewInt("response_cache_misses")
+)
+
+// revalidateKey marks the background request refreshing a stale entry; it is a
+// fasthttp user value rather than a header so clients cannot bypass the cache
+const revalidateKey = "responseCacheRevalidate"
+
+type cachedResponse struct {
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+	// staleUntil end of the window in which the expired response is still served while it is refreshed
+	staleUntil time.Time
+	refreshing bool
+	// tags version of each tag when the response was stored
+	tags map[string]int64
+}
+
+var responseCache = struct {
+	sync.Mutex
+	entries map[string]*cachedResponse
+}{entries: map[string]*cachedResponse{}}
+
+// cacheTags versions shared through the cache_tags table; each instance re-reads them every
+// cacheTagRefresh, so an invalidation elsewhere is seen within a couple of seconds
+var cacheTags = struct {
+	sync.Mutex
+	versions map[string]int64
+	checked  time.Time
+}{versions: map[string]int64{}}
+
+func tagVersions() map[string]int64 {
+	cacheTags.Lock()
+	defer cacheTags.Unlock()
+	if time.Since(cacheTags.checked) > cacheTagRefresh {
+		var rows []model.CacheTag
+		if err := database.DB.Find(&rows).Error; err == nil {
+			versions := make(map[string]int64, len(rows))
+			for _, r := range rows {
+				versions[r.Tag] = r.Version
+			}
+			cacheTags.versions = versions
+		}
+		cacheTags.checked = time.Now()
+	}
+	return cacheTags.versions
+}
+
+// InvalidateCache drop every cached response tagged with any of tags, on every instance.
+// All tags are bumped by one statement, so invalidating a large batch costs a single round trip.
+func InvalidateCache(tags ...string) {
+	// an upsert can't touch a row twice, and a fixed order keeps concurrent batches from deadlocking
+	seen := make(map[string]bool, len(tags))
+	rows := make([]model.CacheTag, 0, len(tags))
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			rows = append(rows, model.CacheTag{Tag: tag, Version: 1})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Tag < rows[j].Tag })
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tag"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"version": gorm.Expr("cache_tags.version + 1")}),
+	}).Create(&rows).Error
+	if err != nil {
+		log.Printf("failed to invalidate %d cache tags: %v", len(rows), err)
+	}
+	// force a reload so this instance stops serving the old responses right away
+	cacheTags.Lock()
+	cacheTags.checked = time.Time{}
+	cacheTags.Unlock()
+}
+
+func cacheKey(c *fiber.Ctx) string {
+	return c.OriginalURL() + "|" + c.Get(fiber.HeaderAccept) + "|" + c.Get(fiber.HeaderAcceptLanguage)
+}
+
+// current report whether none of the response's tags were invalidated since it was stored.
+// Invalidated responses are never served, not even stale.
+func (r *cachedResponse) current(versions map[string]int64) bool {
+	for tag, v := range r.tags {
+		if versions[tag] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func storeResponse(key string, r *cachedResponse) {
+	responseCache.Lock()
+	defer responseCache.Unlock()
+	if len(responseCache.entries) >= maxCachedResponses {
+		for k, e := range responseCache.entries {
+			if time.Now().After(e.staleUntil) {
+				delete(responseCache.entries, k)
+			}
+		}
+		if len(responseCache.entries) >= maxCachedResponses {
+			return
+		}
+	}
+	responseCache.entries[key] = r
+}
+
+// revalidate re-run the request in the background so its handler stores a fresh response
+func revalidate(c *fiber.Ctx, entry *cachedResponse) {
+	responseCache.Lock()
+	if entry.refreshing {
+		responseCache.Unlock()
+		return
+	}
+	entry.refreshing = true
+	responseCache.Unlock()
+
+	fctx := new(fasthttp.RequestCtx)
+	c.Request().CopyTo(&fctx.Request)
+	fctx.SetUserValue(revalidateKey, true)
+	handler := c.App().Handler()
+	go func() {
+		handler(fctx)
+		responseCache.Lock()
+		entry.refreshing = false
+		responseCache.Unlock()
+	}()
+}
+
+func serveCached(c *fiber.Ctx, entry *cachedResponse, state string) error {
+	c.Set("X-Cache", state)
+	c.Set(fiber.HeaderContentType, entry.contentType)
+	return c.Status(entry.status).Send(entry.body)
+}
+
+// ResponseCache serve anonymous GETs from memory for RESPONSE_CACHE_TTL (default 30s, 0 disables).
+// For RESPONSE_CACHE_STALE after that (default 5m) the expired copy is still served at once
+// while one background request refreshes it. tags names the data a response depends on;
+// InvalidateCache with any of them evicts it immediately, stale window included.
+func ResponseCache(tags func(c *fiber.Ctx) []string) fiber.Handler {
+	ttl, err := time.ParseDuration(config.Config("RESPONSE_CACHE_TTL"))
+	if err != nil || ttl < 0 {
+		ttl = 30 * time.Second
+	}
+	stale, err := time.ParseDuration(config.Config("RESPONSE_CACHE_STALE"))
+	if err != nil || stale < 0 {
+		stale = 5 * time.Minute
+	}
+
+	return func(c *fiber.Ctx) error {
+		if ttl == 0 || c.Method() != fiber.MethodGet || c.Get(fiber.HeaderAuthorization) != "" {
+			return c.Next()
+		}
+
+		key := cacheKey(c)
+		versions := tagVersions()
+		if refresh, _ := c.Context().UserValue(revalidateKey).(bool); !refresh {
+			responseCache.Lock()
+			entry, ok := responseCache.entries[key]
+			responseCache.Unlock()
+			if ok && entry.current(versions) {
+				now := time.Now()
+				if now.Before(entry.expires) {
+					cacheHits.Add(1)
+					return serveCached(c, entry, "HIT")
+				}
+				if now.Before(entry.staleUntil) {
+					cacheStale.Add(1)
+					revalidate(c, entry)
+					return serveCached(c, entry, "STALE")
+				}
+			}
+		}
+		cacheMisses.Add(1)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		c.Set("X-Cache", "MISS")
+		if c.Response().StatusCode() != fiber.StatusOK {
+			return nil
+		}
+
+		stored := &cachedResponse{
+			status:      fiber.StatusOK,
+			contentType: string(c.Response().Header.ContentType()),
+			body:        append([]byte(nil), c.Response().Body()...),
+			expires:     time.Now().Add(ttl),
+			staleUntil:  time.Now().Add(ttl + stale),
+			tags:        map[string]int64{},
+		}
+		for _, tag := range tags(c) {
+			stored.tags[tag] = versions[tag]
+		}
+		storeResponse(key, stored)
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"app/config"
+	"expvar"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CanaryHeader request header forcing a variant: "true" for the canary, "false" for stable
+const CanaryHeader = "X-Canary"
+
+var canaryStats = expvar.NewMap("canary")
+
+// canaryPercent share of requests (0-100) served by canaries, from CANARY_PERCENT
+func canaryPercent() uint32 {
+	n, err := strconv.Atoi(config.Config("CANARY_PERCENT"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	if n > 100 {
+		return 100
+	}
+	return uint32(n)
+}
+
+// inCanaryCohort report whether the caller falls in the canary share of name.
+// Users are bucketed by ID so they see one variant consistently; anonymous callers by IP.
+func inCanaryCohort(c *fiber.Ctx, name string, percent uint32) bool {
+	if percent == 0 {
+		return false
+	}
+	caller := c.IP()
+	if auth, err := Claims(c); err == nil {
+		caller = strconv.FormatUint(uint64(auth.UserID), 10)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + caller))
+	return h.Sum32()%100 < percent
+}
+
+// Canary serve next instead of stable when the request sends X-Canary: true or falls in the
+// CANARY_PERCENT cohort. Requests and errors are counted per variant under name in the canary
+// expvar map, so error rates of the two can be compared before a rollout.
+func Canary(name string, stable, next fiber.Handler) fiber.Handler {
+	percent := canaryPercent()
+	return func(c *fiber.Ctx) error {
+		variant, handler := "stable", stable
+		switch c.Get(CanaryHeader) {
+		case "true":
+			variant, handler = "canary", next
+		case "false":
+		default:
+			if inCanaryCohort(c, name, percent) {
+				variant, handler = "canary", next
+			}
+		}
+		c.Set("X-Canary-Variant", variant)
+
+		err := handler(c)
+		canaryStats.Add(name+"."+variant+".requests", 1)
+		if err != nil || c.Response().StatusCode() >= fiber.StatusInternalServerError {
+			canaryStats.Add(name+"."+variant+".errors", 1)
+		}
+		return err
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"app/config"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CaptchaHeader request header carrying the widget's response token
+const CaptchaHeader = "X-Captcha-Token"
+
+var captchaVerifyURLs = map[string]string{
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+}
+
+var captchaClient = &http.Client{Timeout: 5 * time.Second}
+
+// verifyCaptcha ask the provider whether token is a solved challenge
+func verifyCaptcha(verifyURL, secret, token, ip string) (bool, error) {
+	resp, err := captchaClient.PostForm(verifyURL, url.Values{
+		"secret":   {secret},
+		"response": {token},
+		"remoteip": {ip},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// Captcha require a solved hCaptcha or reCAPTCHA challenge in the X-Captcha-Token header
+// when CAPTCHA_PROVIDER is set. Requests fail closed if the provider cannot be reached.
+func Captcha() fiber.Handler {
+	verifyURL, enabled := captchaVerifyURLs[config.Config("CAPTCHA_PROVIDER")]
+	secret := config.Config("CAPTCHA_SECRET")
+	return func(c *fiber.Ctx) error {
+		if !enabled {
+			return c.Next()
+		}
+		token := c.Get(CaptchaHeader)
+		if token == "" {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "code": "CAPTCHA_REQUIRED", "message": "CAPTCHA token missing", "data": nil})
+		}
+
+		ok, err := verifyCaptcha(verifyURL, secret, token, c.IP())
+		if err != nil {
+			log.Println("failed to verify CAPTCHA:", err)
+			return c.Status(fiber.StatusServiceUnavailable).
+				JSON(fiber.Map{"status": "error", "message": "Couldn't verify CAPTCHA, try again", "data": nil})
+		}
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "code": "CAPTCHA_FAILED", "message": "CAPTCHA verification failed", "data": nil})
+		}
+		return c.Next()
+	}
+}
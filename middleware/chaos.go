@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"app/config"
+	"app/database"
+	"app/model"
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ChaosSetting settings key holding the fault injection rules
+const ChaosSetting = "chaos"
+
+const chaosRefresh = 5 * time.Second
+
+// ChaosRule fault injected into Percent of the requests whose path starts with Path
+type ChaosRule struct {
+	Path    string  `json:"path" validate:"required,startswith=/"`
+	Percent float64 `json:"percent" validate:"gt=0,lte=100"`
+	// LatencyMS delay added before the request is handled
+	LatencyMS int `json:"latency_ms" validate:"min=0,max=30000"`
+	// ErrorStatus answered instead of running the handler, 0 to run it
+	ErrorStatus int `json:"error_status" validate:"omitempty,min=400,max=599"`
+	// DropDB run the handler with a cancelled context, failing its queries as if the connection dropped
+	DropDB bool `json:"drop_db"`
+}
+
+var chaos = struct {
+	sync.Mutex
+	rules   []ChaosRule
+	checked time.Time
+}{}
+
+// ChaosEnabled report whether fault injection may be used: CHAOS_ENABLED=true outside production
+func ChaosEnabled() bool {
+	return config.Config("CHAOS_ENABLED") == "true" && config.Config("APP_ENV") != "production"
+}
+
+// SetChaosRules update this instance's rules, others pick them up within a few seconds
+func SetChaosRules(rules []ChaosRule) {
+	chaos.Lock()
+	chaos.rules = rules
+	chaos.checked = time.Now()
+	chaos.Unlock()
+}
+
+// ChaosRules the fault injection rules currently in force
+func ChaosRules() []ChaosRule {
+	chaos.Lock()
+	rules, stale := chaos.rules, time.Since(chaos.checked) > chaosRefresh
+	if stale {
+		// claim the refresh so concurrent requests keep using the current rules meanwhile
+		chaos.checked = time.Now()
+	}
+	chaos.Unlock()
+	if !stale {
+		return rules
+	}
+
+	// read without holding the lock, so a slow query doesn't stall every request
+	var s model.Setting
+	if err := database.DB.Limit(1).Find(&s, "key = ?", ChaosSetting).Error; err != nil {
+		return rules
+	}
+	var loaded []ChaosRule
+	if s.Value != "" {
+		if err := json.Unmarshal([]byte(s.Value), &loaded); err != nil {
+			log.Println("failed to read chaos rules:", err)
+		}
+	}
+	chaos.Lock()
+	chaos.rules = loaded
+	chaos.Unlock()
+	return loaded
+}
+
+// Chaos inject the latency, errors and dropped database connections described by ChaosRules.
+// The admin chaos endpoint is exempt so a drill can always be stopped.
+func Chaos() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if path == "/api/admin/chaos" {
+			return c.Next()
+		}
+		for _, rule := range ChaosRules() {
+			if !strings.HasPrefix(path, rule.Path) || rand.Float64()*100 >= rule.Percent {
+				continue
+			}
+			c.Set("X-Chaos", rule.Path)
+			if rule.LatencyMS > 0 {
+				time.Sleep(time.Duration(rule.LatencyMS) * time.Millisecond)
+			}
+			if rule.ErrorStatus > 0 {
+				return c.Status(rule.ErrorStatus).
+					JSON(fiber.Map{"status": "error", "code": "CHAOS", "message": "Injected fault", "data": nil})
+			}
+			if rule.DropDB {
+				ctx, cancel := context.WithCancel(c.UserContext())
+				cancel()
+				c.SetUserContext(ctx)
+			}
+			break
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AuthContext typed view of the access token's claims
+type AuthContext struct {
+	UserID uint
+	// TokenID jti, empty for tokens issued before tokens carried one
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// AuthTime when the user last entered their password, zero for tokens not issued by a login
+	AuthTime time.Time
+	// Scopes granted to a scoped token; Scoped is false for login tokens, which carry none
+	Scopes []string
+	Scoped bool
+	// Impersonator admin acting through an impersonation token
+	Impersonator *uint
+}
+
+var errMalformedClaims = errors.New("malformed token claims")
+
+// claimID read a numeric claim holding a record ID, rejecting fractions and values out of range
+func claimID(v interface{}) (uint, bool) {
+	f, ok := v.(float64)
+	if !ok || f < 1 || f > 1<<53 || f != math.Trunc(f) {
+		return 0, false
+	}
+	return uint(f), true
+}
+
+func parseClaims(token *jwt.Token) (*AuthContext, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errMalformedClaims
+	}
+	uid, ok := claimID(claims["user_id"])
+	if !ok {
+		return nil, errMalformedClaims
+	}
+
+	auth := &AuthContext{UserID: uid}
+	auth.TokenID, _ = claims["jti"].(string)
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		auth.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		auth.ExpiresAt = exp.Time
+	}
+	if at, ok := claims["auth_time"].(float64); ok {
+		auth.AuthTime = time.Unix(int64(at), 0)
+	}
+	if raw, ok := claims["scopes"].([]interface{}); ok {
+		auth.Scoped = true
+		for _, s := range raw {
+			if str, ok := s.(string); ok {
+				auth.Scopes = append(auth.Scopes, str)
+			}
+		}
+	}
+	if admin, ok := claims["impersonator"]; ok {
+		id, ok := claimID(admin)
+		if !ok {
+			return nil, errMalformedClaims
+		}
+		auth.Impersonator = &id
+	}
+	return auth, nil
+}
+
+// Claims claims of the request's token, parsed once and kept in c.Locals.
+// It errors on requests without a verified token or with claims of the wrong shape.
+func Claims(c *fiber.Ctx) (*AuthContext, error) {
+	if auth, ok := c.Locals("auth").(*AuthContext); ok {
+		return auth, nil
+	}
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil, errors.New("missing token")
+	}
+	auth, err := parseClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	c.Locals("auth", auth)
+	return auth, nil
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func FuzzParseClaims(f *testing.F) {
+	f.Add([]byte(`{"user_id":1,"jti":"abc","iat":1700000000,"exp":1700000900,"auth_time":1700000000}`))
+	f.Add([]byte(`{"user_id":7,"scopes":["products:read",3,null]}`))
+	f.Add([]byte(`{"user_id":2,"impersonator":1}`))
+	f.Add([]byte(`{"user_id":"1"}`))
+	f.Add([]byte(`{"user_id":0}`))
+	f.Add([]byte(`{"user_id":1.5}`))
+	f.Add([]byte(`{"user_id":1e300}`))
+	f.Add([]byte(`{"user_id":1,"iat":"yesterday","exp":[1]}`))
+	f.Add([]byte(`{"user_id":1,"impersonator":-1}`))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		var claims jwt.MapClaims
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return
+		}
+		auth, err := parseClaims(&jwt.Token{Claims: claims})
+		if err != nil {
+			return
+		}
+		uid := claims["user_id"].(float64)
+		if auth.UserID < 1 || float64(auth.UserID) != uid {
+			t.Fatalf("user_id %v parsed as %d", uid, auth.UserID)
+		}
+		if auth.Impersonator != nil {
+			admin := claims["impersonator"].(float64)
+			if *auth.Impersonator < 1 || float64(*auth.Impersonator) != admin {
+				t.Fatalf("impersonator %v parsed as %d", admin, *auth.Impersonator)
+			}
+		}
+	})
+}
+
+func FuzzParseToken(f *testing.F) {
+	f.Add("eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJ1c2VyX2lkIjoxfQ.c2ln")
+	f.Add("eyJhbGciOiJub25lIn0.eyJ1c2VyX2lkIjoiMSJ9.")
+	f.Add("a.b.c")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, raw string) {
+		token, _, err := jwt.NewParser().ParseUnverified(raw, jwt.MapClaims{})
+		if err != nil {
+			return
+		}
+		if auth, err := parseClaims(token); err == nil && auth.UserID < 1 {
+			t.Fatalf("token %q parsed with user %d", raw, auth.UserID)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"app/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+var crawlerSignatures = []string{
+	"googlebot", "bingbot", "slurp", "duckduckbot", "baiduspider", "yandexbot",
+	"applebot", "facebookexternalhit", "twitterbot", "ahrefsbot", "semrushbot",
+	"mj12bot", "petalbot", "bytespider", "gptbot", "ccbot",
+	"crawler", "spider", "bot/",
+}
+
+// IsCrawler report whether the user agent belongs to a known crawler
+func IsCrawler(ua string) bool {
+	ua = strings.ToLower(ua)
+	for _, s := range crawlerSignatures {
+		if strings.Contains(ua, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// CrawlerLimiter rate limit known crawlers separately from regular clients
+func CrawlerLimiter() fiber.Handler {
+	max, err := strconv.Atoi(config.Config("CRAWLER_RATE_LIMIT"))
+	if err != nil || max <= 0 {
+		max = 60
+	}
+
+	return limiter.New(limiter.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return !IsCrawler(c.Get(fiber.HeaderUserAgent))
+		},
+		Max:        max,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "crawler:" + c.IP()
+		},
+		Storage: rateLimitStorage,
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).
+				JSON(fiber.Map{"status": "error", "message": "Too many requests", "data": nil})
+		},
+	})
+}
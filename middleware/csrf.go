@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"app/config"
+	"app/database"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/csrf"
+)
+
+// AccessTokenCookie cookie carrying the access token when AUTH_COOKIE=true
+const AccessTokenCookie = "access_token"
+
+// CookieAuth report whether tokens are delivered as cookies instead of in the response body
+func CookieAuth() bool {
+	return config.Config("AUTH_COOKIE") == "true"
+}
+
+// CSRF require the X-Csrf-Token header to echo the csrf_ cookie on state-changing
+// requests authenticated by the access token cookie. Bearer requests are exempt,
+// a cross-site form cannot set the Authorization header.
+func CSRF() fiber.Handler {
+	return csrf.New(csrf.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return c.Get(fiber.HeaderAuthorization) != "" || c.Cookies(AccessTokenCookie) == ""
+		},
+		CookieSecure:   true,
+		CookieSameSite: "Strict",
+		Storage:        database.Storage{Prefix: "csrf:"},
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Missing or invalid CSRF token", "data": nil})
+		},
+	})
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// envelope shape every handler wraps its JSON responses in
+type envelope struct {
+	Status  string                     `json:"status"`
+	Code    string                     `json:"code"`
+	Message string                     `json:"message"`
+	Data    json.RawMessage            `json:"data"`
+	Errors  json.RawMessage            `json:"errors"`
+	Meta    map[string]json.RawMessage `json:"meta"`
+}
+
+// wantsRaw report whether the client opted out of the envelope with ?envelope=false
+// or an Accept of application/json; profile="raw"
+func wantsRaw(c *fiber.Ctx) bool {
+	if c.Query("envelope") == "false" {
+		return true
+	}
+	accept := c.Get(fiber.HeaderAccept)
+	return strings.Contains(accept, fiber.MIMEApplicationJSON) && strings.Contains(accept, `profile="raw"`)
+}
+
+// rewrite replace the envelope of a finished JSON response: with the bare resource when raw is set,
+// and with problem+json for errors. meta.total is kept in X-Total-Count; pagination links are
+// already in the Link header.
+func rewrite(c *fiber.Ctx, raw bool) {
+	resp := c.Response()
+	if !strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return
+	}
+	var env envelope
+	if err := json.Unmarshal(resp.Body(), &env); err != nil || env.Status == "" {
+		return
+	}
+
+	status := resp.StatusCode()
+	if env.Status == "success" && status < fiber.StatusBadRequest {
+		if !raw {
+			return
+		}
+		if total, ok := env.Meta["total"]; ok {
+			c.Set("X-Total-Count", string(total))
+		}
+		body := env.Data
+		if len(body) == 0 {
+			body = json.RawMessage("null")
+		}
+		resp.SetBodyRaw(body)
+		return
+	}
+
+	if status < fiber.StatusBadRequest {
+		status = fiber.StatusInternalServerError
+	}
+	b, err := json.Marshal(problem(c, status, env.Message, env.Code, env.Errors))
+	if err != nil {
+		return
+	}
+	c.Status(status)
+	resp.SetBodyRaw(b)
+	c.Set(fiber.HeaderContentType, MIMEProblemJSON)
+}
+
+// Envelope serve bare resources to clients that opt out of the {status, message, data} envelope,
+// and problem+json errors to them and to clients accepting application/problem+json.
+// Everyone else gets responses unchanged.
+func Envelope() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		raw := wantsRaw(c)
+		if !raw && !wantsProblem(c) {
+			return c.Next()
+		}
+		// errors returned instead of written are formatted by ErrorHandler
+		if err := c.Next(); err != nil {
+			return err
+		}
+		rewrite(c, raw)
+		return nil
+	}
+}
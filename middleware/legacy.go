@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var legacyFieldUsage = expvar.NewMap("legacy_fields")
+
+// LegacyFields rename deprecated JSON body keys to their current names before the handler runs.
+// renames maps legacy key to current key; the current key wins when a client sends both.
+// Each use is counted under endpoint.key in the legacy_fields expvar map.
+func LegacyFields(endpoint string, renames map[string]string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return c.Next()
+		}
+
+		var used []string
+		for legacy, current := range renames {
+			v, ok := body[legacy]
+			if !ok {
+				continue
+			}
+			delete(body, legacy)
+			if _, ok := body[current]; !ok {
+				body[current] = v
+			}
+			used = append(used, legacy)
+			legacyFieldUsage.Add(endpoint+"."+legacy, 1)
+		}
+		if len(used) == 0 {
+			return c.Next()
+		}
+
+		b, err := json.Marshal(body)
+		if err != nil {
+			return c.Next()
+		}
+		c.Request().SetBody(b)
+
+		sort.Strings(used)
+		warnings := make([]string, len(used))
+		for i, legacy := range used {
+			warnings[i] = fmt.Sprintf(`299 - "field %q is deprecated, use %q"`, legacy, renames[legacy])
+		}
+		c.Set("Deprecation", "true")
+		c.Set(fiber.HeaderWarning, strings.Join(warnings, ", "))
+		return c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+type memoEntry struct {
+	value interface{}
+	err   error
+}
+
+// Memo run load once per request for key; later calls in the same request, from
+// middleware or handler alike, get the first result without querying again
+func Memo[T any](c *fiber.Ctx, key string, load func() (T, error)) (T, error) {
+	memo, ok := c.Locals("memo").(map[string]memoEntry)
+	if !ok {
+		memo = map[string]memoEntry{}
+		c.Locals("memo", memo)
+	}
+	if e, ok := memo[key]; ok {
+		v, _ := e.value.(T)
+		return v, e.err
+	}
+
+	v, err := load()
+	memo[key] = memoEntry{value: v, err: err}
+	return v, err
+}
+
+// Forget drop key from the request's memo after the underlying row changed
+func Forget(c *fiber.Ctx, key string) {
+	if memo, ok := c.Locals("memo").(map[string]memoEntry); ok {
+		delete(memo, key)
+	}
+}
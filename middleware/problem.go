@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MIMEProblemJSON media type of RFC 7807 error responses
+const MIMEProblemJSON = "application/problem+json"
+
+// wantsProblem report whether errors should be sent as problem+json: the client accepts
+// application/problem+json or opted out of the envelope
+func wantsProblem(c *fiber.Ctx) bool {
+	return wantsRaw(c) || strings.Contains(c.Get(fiber.HeaderAccept), MIMEProblemJSON)
+}
+
+// problem RFC 7807 body for status; code and errors are our extensions, left out when empty
+func problem(c *fiber.Ctx, status int, detail, code string, errs json.RawMessage) fiber.Map {
+	p := fiber.Map{
+		"type":     "about:blank",
+		"title":    http.StatusText(status),
+		"status":   status,
+		"detail":   detail,
+		"instance": c.OriginalURL(),
+	}
+	if code != "" {
+		p["code"] = code
+	}
+	if len(errs) > 0 && string(errs) != "null" {
+		p["errors"] = errs
+	}
+	return p
+}
+
+// ErrorHandler answer errors returned by handlers and middleware, such as unknown routes, in the
+// {status, message, data} envelope or, when the client asks for it, as problem+json
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status, message := fiber.StatusInternalServerError, "Internal Server Error"
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		status, message = fe.Code, fe.Message
+	} else {
+		log.Printf("unhandled error on %s %s: %v", c.Method(), c.Path(), err)
+	}
+
+	if wantsProblem(c) {
+		return c.Status(status).JSON(problem(c, status, message, "", nil), MIMEProblemJSON)
+	}
+	return c.Status(status).JSON(fiber.Map{"status": "error", "message": message, "data": nil})
+}
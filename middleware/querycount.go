@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"app/config"
+	"app/database"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueryCount set X-Query-Count to the number of SQL statements the request ran and log a
+// warning once it reaches QUERY_COUNT_WARN (default 20), which usually means a lookup that
+// should be memoized or a list loading rows one by one. Meant for APP_ENV=dev only.
+func QueryCount() fiber.Handler {
+	threshold, err := strconv.ParseInt(config.Config("QUERY_COUNT_WARN"), 10, 64)
+	if err != nil || threshold <= 0 {
+		threshold = 20
+	}
+	return func(c *fiber.Ctx) error {
+		ctx, n := database.CountQueries(c.UserContext())
+		c.SetUserContext(ctx)
+		err := c.Next()
+
+		count := n.Load()
+		c.Set("X-Query-Count", strconv.FormatInt(count, 10))
+		if count >= threshold {
+			log.Printf("WARNING: %s %s ran %d queries", c.Method(), c.OriginalURL(), count)
+		}
+		return err
+	}
+}
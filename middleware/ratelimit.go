@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"app/config"
+	"app/database"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const rateLimitWarnRatio = 0.8
+
+// rateLimitStorage counters shared by every prefork child and replica, so a limit holds fleet-wide
+// instead of being multiplied by the number of processes
+var rateLimitStorage = database.Storage{Prefix: "ratelimit:"}
+
+// RateLimitWarning set X-RateLimit-Warning once a client has used 80% of its quota.
+// Register it before the limiter so the limiter's headers are visible on the way out.
+func RateLimitWarning() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		limit, lerr := strconv.Atoi(string(c.Response().Header.Peek("X-RateLimit-Limit")))
+		remaining, rerr := strconv.Atoi(string(c.Response().Header.Peek("X-RateLimit-Remaining")))
+		if lerr != nil || rerr != nil || limit <= 0 {
+			return err
+		}
+
+		used := limit - remaining
+		if float64(used) >= float64(limit)*rateLimitWarnRatio {
+			c.Set("X-RateLimit-Warning", strconv.Itoa(used)+" of "+strconv.Itoa(limit)+" requests used, slow down to avoid being blocked")
+		}
+		return err
+	}
+}
+
+// AuthLimiter limit credential endpoints to AUTH_RATE_LIMIT requests per minute per IP (default 5).
+// Share one instance between routes so they draw from the same quota.
+func AuthLimiter() fiber.Handler {
+	max, err := strconv.Atoi(config.Config("AUTH_RATE_LIMIT"))
+	if err != nil || max <= 0 {
+		max = 5
+	}
+
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "auth:" + c.IP()
+		},
+		Storage: rateLimitStorage,
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).
+				JSON(fiber.Map{"status": "error", "message": "Too many requests", "data": nil})
+		},
+	})
+}
+
+// SuggestLimiter limit typeahead requests to SUGGEST_RATE_LIMIT per minute per IP (default 120),
+// enough for debounced keystrokes but not for scraping the catalog
+func SuggestLimiter() fiber.Handler {
+	max, err := strconv.Atoi(config.Config("SUGGEST_RATE_LIMIT"))
+	if err != nil || max <= 0 {
+		max = 120
+	}
+
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "suggest:" + c.IP()
+		},
+		Storage: rateLimitStorage,
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).
+				JSON(fiber.Map{"status": "error", "message": "Too many requests", "data": nil})
+		},
+	})
+}
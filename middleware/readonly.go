@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"app/config"
+	"app/database"
+	"app/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReadOnlySetting settings key toggled by admins
+const ReadOnlySetting = "read_only"
+
+const readOnlyRefresh = 5 * time.Second
+
+// readOnlyForced READ_ONLY=true, read once since it can only change with a restart
+var readOnlyForced = sync.OnceValue(func() bool {
+	return config.Config("READ_ONLY") == "true"
+})
+
+// readOnlyGetWrites GET routes that change state, refused in read-only mode like other writes
+var readOnlyGetWrites = map[string]bool{
+	"/api/user/email/confirm": true,
+}
+
+var readOnly = struct {
+	sync.Mutex
+	enabled bool
+	checked time.Time
+}{}
+
+// SetReadOnly update this instance's view of the admin toggle, others pick it up within a few seconds
+func SetReadOnly(enabled bool) {
+	readOnly.Lock()
+	readOnly.enabled = enabled
+	readOnly.checked = time.Now()
+	readOnly.Unlock()
+}
+
+// IsReadOnly report whether mutating requests are currently refused
+func IsReadOnly() bool {
+	if readOnlyForced() {
+		return true
+	}
+
+	readOnly.Lock()
+	enabled, stale := readOnly.enabled, time.Since(readOnly.checked) > readOnlyRefresh
+	if stale {
+		// claim the refresh so concurrent requests keep using the current state meanwhile
+		readOnly.checked = time.Now()
+	}
+	readOnly.Unlock()
+	if !stale {
+		return enabled
+	}
+
+	// read without holding the lock, so a slow query doesn't stall every request
+	var s model.Setting
+	if err := database.DB.Limit(1).Find(&s, "key = ?", ReadOnlySetting).Error; err != nil {
+		return enabled
+	}
+	enabled = s.Value == "true"
+	readOnly.Lock()
+	readOnly.enabled = enabled
+	readOnly.Unlock()
+	return enabled
+}
+
+func readOnlyAllowlist() map[string]bool {
+	paths := config.Config("READ_ONLY_ALLOW")
+	if paths == "" {
+		paths = "/api/auth/logout"
+	}
+	allow := map[string]bool{"/api/admin/read-only": true}
+	for _, p := range strings.Split(paths, ",") {
+		allow[strings.TrimSpace(p)] = true
+	}
+	return allow
+}
+
+// ReadOnly answer 503 READ_ONLY to mutating requests while read-only mode is on,
+// including the GET routes in readOnlyGetWrites
+func ReadOnly() fiber.Handler {
+	allow := readOnlyAllowlist()
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			if !readOnlyGetWrites[c.Path()] {
+				return c.Next()
+			}
+		}
+		if allow[c.Path()] || !IsReadOnly() {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusServiceUnavailable).
+			JSON(fiber.Map{"status": "error", "code": "READ_ONLY", "message": "The API is in read-only mode", "data": nil})
+	}
+}
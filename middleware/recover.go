@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"app/random"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var panics = expvar.NewInt("panics")
+
+func newIncidentID() string {
+	id, err := random.Hex(8)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return id
+}
+
+// Recover turn panics into a JSON 500 carrying an incident ID and log the stack trace
+func Recover() fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			panics.Add(1)
+			incident := newIncidentID()
+
+			report, _ := json.Marshal(map[string]interface{}{
+				"level":       "error",
+				"event":       "panic",
+				"incident_id": incident,
+				"panic":       fmt.Sprint(r),
+				"method":      c.Method(),
+				"path":        c.Path(),
+				"ip":          c.IP(),
+				"user_agent":  c.Get(fiber.HeaderUserAgent),
+				"time":        time.Now().UTC().Format(time.RFC3339),
+				"stack":       string(debug.Stack()),
+			})
+			log.Println(string(report))
+
+			err = c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Internal Server Error",
+				"data":    fiber.Map{"incident_id": incident},
+			})
+		}()
+		return c.Next()
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"app/clock"
+	"app/config"
+	"app/database"
+	"app/model"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+func replayWindow() time.Duration {
+	window, err := time.ParseDuration(config.Config("REPLAY_WINDOW"))
+	if err != nil || window <= 0 {
+		return 5 * time.Minute
+	}
+	return window
+}
+
+func replayError(c *fiber.Ctx, status int, message string) error {
+	return c.Status(status).JSON(fiber.Map{"status": "error", "message": message, "data": nil})
+}
+
+// requestSignature hex HMAC-SHA256 binding the nonce and timestamp to the request's method, path and body
+func requestSignature(secret []byte, c *fiber.Ctx, nonce, ts string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(c.Method() + "\n" + c.Path() + "\n" + ts + "\n" + nonce + "\n"))
+	mac.Write(c.Body())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReplayProtection reject stale, replayed or unsigned requests carrying X-Request-Nonce and X-Request-Timestamp.
+// X-Request-Signature must be requestSignature under REPLAY_SECRET, or a captured request could be sent
+// again with fresh headers. Clients that omit the headers pass unless REPLAY_PROTECTION=required.
+func ReplayProtection() fiber.Handler {
+	secret := []byte(config.Config("REPLAY_SECRET"))
+	required := config.Config("REPLAY_PROTECTION") == "required"
+	if len(secret) == 0 {
+		log.Println("REPLAY_SECRET is unset, request signatures can't be checked")
+	}
+
+	return func(c *fiber.Ctx) error {
+		nonce := c.Get("X-Request-Nonce")
+		ts := c.Get("X-Request-Timestamp")
+		sig := c.Get("X-Request-Signature")
+		if nonce == "" && ts == "" && sig == "" {
+			if required {
+				return replayError(c, fiber.StatusBadRequest, "Missing request nonce, timestamp or signature")
+			}
+			return c.Next()
+		}
+		if len(secret) == 0 {
+			return replayError(c, fiber.StatusServiceUnavailable, "Request signing is not configured")
+		}
+
+		if len(nonce) < 16 || len(nonce) > 128 {
+			return replayError(c, fiber.StatusBadRequest, "Invalid request nonce")
+		}
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return replayError(c, fiber.StatusBadRequest, "Invalid request timestamp")
+		}
+
+		if !hmac.Equal([]byte(sig), []byte(requestSignature(secret, c, nonce, ts))) {
+			return replayError(c, fiber.StatusUnauthorized, "Invalid request signature")
+		}
+
+		window := replayWindow()
+		sent := time.Unix(unix, 0)
+		if age := clock.Since(sent); age > window || age < -window {
+			return replayError(c, fiber.StatusUnauthorized, "Stale request")
+		}
+
+		used := model.RequestNonce{Value: nonce, ExpiresAt: sent.Add(window)}
+		res := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&used)
+		if res.Error != nil {
+			return replayError(c, fiber.StatusInternalServerError, "Internal Server Error")
+		}
+		if res.RowsAffected == 0 {
+			return replayError(c, fiber.StatusUnauthorized, "Replayed request")
+		}
+		return c.Next()
+	}
+}
+
+// PurgeNonces delete nonces whose timestamps can no longer be replayed
+func PurgeNonces(ctx context.Context) error {
+	return database.DB.WithContext(ctx).Where("expires_at < ?", clock.Now()).Delete(&model.RequestNonce{}).Error
+}
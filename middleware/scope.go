@@ -0,0 +1,47 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// Token scopes. Login tokens carry none and may do anything the user can;
+// tokens issued with scopes are limited to routes guarded by one of them.
+const (
+	ScopeProductsRead  = "products:read"
+	ScopeProductsWrite = "products:write"
+	ScopeUsersWrite    = "users:write"
+	// scopeFull never issued, guards routes only unscoped tokens may use
+	scopeFull = "full"
+)
+
+// Scopes every scope a token can be issued with
+var Scopes = []string{ScopeProductsRead, ScopeProductsWrite, ScopeUsersWrite}
+
+// TokenScopes scopes of the request's token, ok is false for unscoped tokens
+func TokenScopes(c *fiber.Ctx) (scopes []string, ok bool) {
+	auth, err := Claims(c)
+	if err != nil {
+		return nil, false
+	}
+	return auth.Scopes, auth.Scoped
+}
+
+// RequireScope refuse scoped tokens lacking scope; unscoped tokens pass
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, scoped := TokenScopes(c)
+		if !scoped {
+			return c.Next()
+		}
+		for _, s := range scopes {
+			if s == scope {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "Token is missing the " + scope + " scope", "data": nil})
+	}
+}
+
+// RequireFullToken refuse scoped tokens, for admin routes and issuing new tokens
+func RequireFullToken() fiber.Handler {
+	return RequireScope(scopeFull)
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"app/clock"
+	"app/config"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultStepUpMaxAge how long after a login sensitive routes stay open without re-authenticating
+const defaultStepUpMaxAge = 10 * time.Minute
+
+// RequireFreshAuth refuse tokens whose login is older than STEP_UP_MAX_AGE (default 10m) with
+// 401 STEP_UP_REQUIRED, so the client can ask for the password again, log in and retry
+func RequireFreshAuth() fiber.Handler {
+	maxAge, err := time.ParseDuration(config.Config("STEP_UP_MAX_AGE"))
+	if err != nil || maxAge <= 0 {
+		maxAge = defaultStepUpMaxAge
+	}
+	return func(c *fiber.Ctx) error {
+		auth, err := Claims(c)
+		if err == nil && !auth.AuthTime.IsZero() && clock.Since(auth.AuthTime) <= maxAge {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"code":    "STEP_UP_REQUIRED",
+			"message": "Recent authentication required, log in again and retry",
+			"data":    fiber.Map{"max_age": int(maxAge.Seconds())},
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"app/audit"
+	"app/database"
+	"app/model"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const userCacheTTL = 30 * time.Second
+
+type cachedUser struct {
+	user    model.User
+	expires time.Time
+}
+
+var userCache = struct {
+	sync.RWMutex
+	entries map[uint]cachedUser
+}{entries: map[uint]cachedUser{}}
+
+// ForgetUser drop a user from the LoadUser cache after it changed
+func ForgetUser(id uint) {
+	userCache.Lock()
+	delete(userCache.entries, id)
+	userCache.Unlock()
+}
+
+func findUser(db *gorm.DB, id uint) (*model.User, error) {
+	userCache.RLock()
+	entry, ok := userCache.entries[id]
+	userCache.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		user := entry.user
+		return &user, nil
+	}
+
+	var user model.User
+	if err := db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+
+	userCache.Lock()
+	userCache.entries[id] = cachedUser{user: user, expires: time.Now().Add(userCacheTTL)}
+	userCache.Unlock()
+	return &user, nil
+}
+
+// LoadUser load the token's user into c.Locals, rejecting deleted or suspended users
+// and tokens issued before the user's last forced logout
+func LoadUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		auth, err := Claims(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "Invalid or expired JWT", "data": nil})
+		}
+
+		db := database.DB.WithContext(c.UserContext())
+		user, err := findUser(db, auth.UserID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "User no longer exists", "data": nil})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "Couldn't load user", "errors": err.Error()})
+		}
+		// role changes, suspensions and forced logouts must apply at once on every process and
+		// replica, so they are read fresh instead of from the per-process cache
+		var access struct {
+			Role            string
+			SuspendedAt     *time.Time
+			TokensRevokedAt *time.Time
+		}
+		err = db.Model(&model.User{}).Select("role", "suspended_at", "tokens_revoked_at").Where("id = ?", user.ID).Take(&access).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "User no longer exists", "data": nil})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "Couldn't load user", "errors": err.Error()})
+		}
+		user.Role, user.SuspendedAt, user.TokensRevokedAt = access.Role, access.SuspendedAt, access.TokensRevokedAt
+
+		if user.SuspendedAt != nil {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Account suspended", "data": nil})
+		}
+		if user.TokensRevokedAt != nil {
+			// iat has whole seconds, so a token from the second of the revocation is revoked too
+			if auth.IssuedAt.Unix() <= user.TokensRevokedAt.Unix() {
+				return c.Status(fiber.StatusUnauthorized).
+					JSON(fiber.Map{"status": "error", "message": "Invalid or expired JWT", "data": nil})
+			}
+		}
+
+		c.Locals("currentUser", user)
+		c.SetUserContext(database.WithActor(c.UserContext(), user.ID))
+
+		if auth.Impersonator == nil {
+			return c.Next()
+		}
+		err = c.Next()
+		audit.Record(c, audit.Entry{
+			Action:     audit.ImpersonatedRequest,
+			Success:    err == nil && c.Response().StatusCode() < fiber.StatusBadRequest,
+			ActorID:    auth.Impersonator,
+			TargetType: "user",
+			TargetID:   audit.Target(user.ID),
+			Details:    map[string]interface{}{"method": c.Method(), "path": c.Path(), "status": c.Response().StatusCode()},
+		})
+		return err
+	}
+}
+
+// Impersonator admin acting through an impersonation token, nil for ordinary requests
+func Impersonator(c *fiber.Ctx) *uint {
+	auth, err := Claims(c)
+	if err != nil {
+		return nil
+	}
+	return auth.Impersonator
+}
+
+// NotImpersonated refuse the route to impersonation tokens, for actions only the real user may take
+func NotImpersonated() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Impersonator(c) != nil {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Not allowed while impersonating", "data": nil})
+		}
+		return c.Next()
+	}
+}
+
+// CurrentUser user loaded by LoadUser, nil when the middleware did not run
+func CurrentUser(c *fiber.Ctx) *model.User {
+	user, _ := c.Locals("currentUser").(*model.User)
+	return user
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// AnalyticsEvent client-side product analytics event from a consenting user
+type AnalyticsEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     uint      `gorm:"not null;index" json:"user_id"`
+	Name       string    `gorm:"not null;size:100;index" json:"name"`
+	Properties JSON      `json:"properties"`
+	OccurredAt time.Time `gorm:"not null;index" json:"occurred_at"`
+}
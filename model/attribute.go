@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Attribute types
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+// CategoryAttribute typed attribute products in a category and its subcategories may carry
+type CategoryAttribute struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	CategoryID uint      `gorm:"not null;uniqueIndex:idx_category_attributes_key" json:"category_id"`
+	Key        string    `gorm:"not null;size:50;uniqueIndex:idx_category_attributes_key" json:"key"`
+	Type       string    `gorm:"not null;size:20" json:"type"`
+	// Options allowed values of an enum attribute, a JSON array of strings
+	Options  JSON `json:"options,omitempty"`
+	Required bool `gorm:"not null;default:false" json:"required"`
+}
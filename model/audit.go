@@ -0,0 +1,31 @@
+package model
+
+import (
+	"app/idgen"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditLog security-relevant action and who performed it
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id,string"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Action     string    `gorm:"not null;size:100;index" json:"action"`
+	Success    bool      `gorm:"not null" json:"success"`
+	ActorID    *uint     `gorm:"index" json:"actor_id"`
+	TargetType string    `gorm:"size:50" json:"target_type"`
+	TargetID   *uint     `json:"target_id"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	RequestID  string    `gorm:"size:64" json:"request_id"`
+	Details    JSON      `json:"details"`
+}
+
+// BeforeCreate assign a time-ordered ID instead of drawing from the sequence
+func (l *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == 0 {
+		l.ID = uint(idgen.Next())
+	}
+	return nil
+}
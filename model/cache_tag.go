@@ -0,0 +1,7 @@
+package model
+
+// CacheTag version of a response cache tag, bumped to invalidate every response carrying it
+type CacheTag struct {
+	Tag     string `gorm:"primaryKey;size:255"`
+	Version int64  `gorm:"not null;default:0"`
+}
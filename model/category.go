@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Category node in the product category tree
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"not null;size:100" json:"name"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	// Path materialized ancestor IDs ending with the category's own, as "1/4/9/", so a subtree is a prefix match
+	Path string `gorm:"not null;size:255" json:"path"`
+
+	Children []*Category `gorm:"-" json:"children,omitempty"`
+}
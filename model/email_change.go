@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// EmailChange address a user asked to switch to, applied once the link sent there is followed
+type EmailChange struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"not null;uniqueIndex"`
+	NewEmail  string    `gorm:"not null;size:255"`
+	// TokenHash SHA-256 of the confirmation token, the token itself is only in the email
+	TokenHash string `gorm:"not null;size:64;uniqueIndex"`
+}
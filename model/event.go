@@ -0,0 +1,27 @@
+package model
+
+import (
+	"app/idgen"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event append-only record of a domain event
+type Event struct {
+	ID            uint      `gorm:"primaryKey" json:"id,string"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+	Type          string    `gorm:"not null;size:100;index" json:"type"`
+	AggregateType string    `gorm:"not null;size:50;index:idx_events_aggregate" json:"aggregate_type"`
+	AggregateID   uint      `gorm:"not null;index:idx_events_aggregate" json:"aggregate_id"`
+	ActorID       *uint     `json:"actor_id"`
+	Payload       JSON      `json:"payload"`
+}
+
+// BeforeCreate assign a time-ordered ID instead of drawing from the sequence
+func (e *Event) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == 0 {
+		e.ID = uint(idgen.Next())
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Experiment A/B test with weighted variants
+type Experiment struct {
+	gorm.Model
+	Stamps
+	Key      string              `gorm:"uniqueIndex;not null;size:100" validate:"required,max=100" json:"key"`
+	Name     string              `gorm:"not null" validate:"required" json:"name"`
+	Active   bool                `gorm:"not null;default:false" json:"active"`
+	Variants []ExperimentVariant `validate:"required,min=2,dive" json:"variants"`
+}
+
+// ExperimentVariant arm of an experiment receiving Weight parts of the traffic
+type ExperimentVariant struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	ExperimentID uint   `gorm:"not null;index" json:"-"`
+	Key          string `gorm:"not null;size:100" validate:"required,max=100" json:"key"`
+	Weight       int    `gorm:"not null" validate:"min=0" json:"weight"`
+}
+
+// ExperimentExposure user shown a variant
+type ExperimentExposure struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExperimentID uint      `gorm:"not null;index" json:"experiment_id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	Variant      string    `gorm:"not null;size:100" json:"variant"`
+}
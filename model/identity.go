@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Identity providers
+const (
+	ProviderPassword = "password"
+	ProviderPhone    = "phone"
+	ProviderGoogle   = "google"
+	ProviderGitHub   = "github"
+	ProviderSAML     = "saml"
+)
+
+// Identity one way of signing in to a user's account. ProviderUserID is the subject the
+// provider knows the user by: the user ID for passwords, the E.164 number for phones.
+type Identity struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UserID         uint      `gorm:"not null;index" json:"user_id"`
+	Provider       string    `gorm:"not null;size:20;uniqueIndex:idx_identities_provider_subject" json:"provider"`
+	ProviderUserID string    `gorm:"not null;size:255;uniqueIndex:idx_identities_provider_subject" json:"provider_user_id"`
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// IPAllowlistEntry network a user's tokens may be issued to; a user with no entries is unrestricted
+type IPAllowlistEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	CIDR      string    `gorm:"not null;size:64" json:"cidr"`
+	Note      string    `gorm:"size:255" json:"note"`
+}
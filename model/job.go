@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job long-running task that clients poll instead of holding a request open
+type Job struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `gorm:"index" json:"updated_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Type      string    `gorm:"not null;size:50" json:"type"`
+	Status    string    `gorm:"not null;size:20;default:queued" json:"status"`
+	// Progress percentage done, 0-100
+	Progress int  `gorm:"not null;default:0" json:"progress"`
+	Errors   JSON `json:"errors"`
+	// Result download produced by a succeeded job
+	Result     []byte     `json:"-"`
+	ResultType string     `gorm:"size:100" json:"-"`
+	ResultName string     `gorm:"size:255" json:"-"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// RequestNonce nonce already used by a client, kept until its timestamp leaves the replay window
+type RequestNonce struct {
+	Value     string    `gorm:"primaryKey;size:128"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
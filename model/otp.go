@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// One-time code purposes
+const (
+	OTPLogin       = "login"
+	OTPVerifyPhone = "verify_phone"
+)
+
+// OTPCode one-time code sent by SMS, stored only as an HMAC
+type OTPCode struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"not null;index"`
+	Purpose   string    `gorm:"not null;size:20"`
+	Phone     string    `gorm:"not null;size:20"`
+	CodeHash  string    `gorm:"not null;size:64"`
+	Attempts  int       `gorm:"not null;default:0"`
+}
@@ -1,11 +1,38 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Product struct
 type Product struct {
 	gorm.Model
+	Stamps
 	Title       string `gorm:"not null" json:"title"`
 	Description string `gorm:"not null" json:"description"`
-	Amount      int    `gorm:"not null" json:"amount"`
+	// DescriptionHTML Description rendered from Markdown and sanitized, kept in sync by the handlers
+	DescriptionHTML string `gorm:"not null;default:''" json:"description_html"`
+	Amount          int    `gorm:"not null" json:"amount"`
+	// Currency ISO 4217 code Amount is priced in
+	Currency   string `gorm:"not null;size:3;default:USD" json:"currency"`
+	ViewCount  int64  `gorm:"not null;default:0" json:"view_count"`
+	CategoryID *uint  `gorm:"index" json:"category_id"`
+	// Attributes values for the category's attribute schema, keyed by attribute key
+	Attributes JSON `json:"attributes"`
+	// HiddenAt when an admin hid the product from listings and lookups, nil while it is visible
+	HiddenAt *time.Time `gorm:"index" json:"hidden_at,omitempty"`
+
+	// Locale of the translation Title and Description were replaced with, never stored
+	Locale string `gorm:"-" json:"locale,omitempty"`
+	// DisplayPrice Amount converted to the currency the client asked for, never stored
+	DisplayPrice *Price `gorm:"-" json:"display_price,omitempty"`
+}
+
+// Price amount in a currency, with the exchange rate used to convert it
+type Price struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
 }
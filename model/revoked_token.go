@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// RevokedToken access token ID denied until the token would have expired anyway
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
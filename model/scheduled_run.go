@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// ScheduledRun last time a scheduler job started anywhere in the fleet
+type ScheduledRun struct {
+	Name      string    `gorm:"primaryKey;size:100"`
+	LastRunAt time.Time `gorm:"not null"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Setting runtime setting shared by every instance
+type Setting struct {
+	Key       string `gorm:"primaryKey;size:100"`
+	Value     string `gorm:"not null"`
+	UpdatedAt time.Time
+}
@@ -0,0 +1,7 @@
+package model
+
+// Stamps who created and last updated a row, filled in from the request's user by database callbacks
+type Stamps struct {
+	CreatedBy *uint `json:"created_by"`
+	UpdatedBy *uint `json:"updated_by"`
+}
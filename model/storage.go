@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// StorageEntry key/value row backing middleware storage shared by every instance
+type StorageEntry struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	Value     []byte
+	ExpiresAt *time.Time `gorm:"index"`
+}
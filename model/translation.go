@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// ProductTranslation a product's title and description in one locale
+type ProductTranslation struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ProductID uint      `gorm:"not null;uniqueIndex:idx_product_translations_locale" json:"product_id"`
+	// Locale canonical BCP 47 tag, such as es or pt-BR
+	Locale          string `gorm:"not null;size:35;uniqueIndex:idx_product_translations_locale" json:"locale"`
+	Title           string `gorm:"not null" json:"title"`
+	Description     string `gorm:"not null" json:"description"`
+	DescriptionHTML string `gorm:"not null;default:''" json:"description_html"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// TrendingProduct popularity score computed by the trending job
+type TrendingProduct struct {
+	ProductID  uint      `gorm:"primaryKey" json:"product_id"`
+	Score      float64   `gorm:"not null;index" json:"score"`
+	ComputedAt time.Time `gorm:"not null" json:"computed_at"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Upload statuses
+const (
+	UploadPending  = "pending"
+	UploadComplete = "complete"
+	// UploadQuarantined malware was found; the file is kept for review but can't be used
+	UploadQuarantined = "quarantined"
+)
+
+// Scan statuses of an upload
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanFailed   = "failed"
+	// ScanSkipped scanning is disabled with SCANNER=none
+	ScanSkipped = "skipped"
+)
+
+// Upload file sent in parts so an interrupted transfer can resume where it stopped
+type Upload struct {
+	ID        string    `gorm:"primaryKey;size:32" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Filename  string    `gorm:"not null;size:255" json:"filename"`
+	Size      int64     `gorm:"not null" json:"size"`
+	// SHA256 hex digest of the whole file, checked on completion
+	SHA256        string     `gorm:"not null;size:64" json:"sha256"`
+	Status        string     `gorm:"not null;size:20;default:pending" json:"status"`
+	ScanStatus    string     `gorm:"not null;size:20;default:pending" json:"scan_status"`
+	ScanSignature string     `gorm:"size:255" json:"scan_signature,omitempty"`
+	ScannedAt     *time.Time `json:"scanned_at"`
+	// Data assembled file, set on completion
+	Data []byte `json:"-"`
+}
+
+// UploadPart one numbered chunk of an upload, replaced when sent again
+type UploadPart struct {
+	UploadID string `gorm:"primaryKey;size:32" json:"-"`
+	Number   int    `gorm:"primaryKey;autoIncrement:false" json:"number"`
+	Size     int    `gorm:"not null" json:"size"`
+	SHA256   string `gorm:"not null;size:64" json:"sha256"`
+	Data     []byte `json:"-"`
+}
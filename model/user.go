@@ -1,12 +1,38 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// RoleGuest synthetic account behind a guest token, merged into a real one on registration
+	RoleGuest = "guest"
+)
 
 // User struct
 type User struct {
 	gorm.Model
-	Username string `gorm:"uniqueIndex;not null;size:50;" validate:"required,min=3,max=50" json:"username"`
-	Email    string `gorm:"uniqueIndex;not null;size:255;" validate:"required,email" json:"email"`
-	Password string `gorm:"not null;" validate:"required,min=6,max=50" json:"password"`
+	Stamps
+	Username string `gorm:"uniqueIndex:idx_users_username_active,where:deleted_at IS NULL;not null;size:50;" validate:"required,min=3,max=50,safe_username" json:"username"`
+	Email    string `gorm:"uniqueIndex:idx_users_email_active,where:deleted_at IS NULL;not null;size:255;" validate:"required,email,not_disposable_email" json:"email"`
+	Password string `gorm:"not null;" validate:"required,min=8,max=50,strong_password,not_breached_password" json:"password"`
 	Names    string `json:"names"`
+	Role     string `gorm:"not null;size:20;default:user" json:"role"`
+
+	AnalyticsConsent bool `gorm:"not null;default:false" json:"analytics_consent"`
+
+	// PhoneNumber E.164 number for SMS codes, unique among verified numbers; never exposed in user JSON
+	PhoneNumber     *string    `gorm:"size:20;uniqueIndex:idx_users_phone_verified,where:deleted_at IS NULL AND phone_verified_at IS NOT NULL" json:"-"`
+	PhoneVerifiedAt *time.Time `json:"-"`
+
+	SuspendedAt *time.Time `json:"suspended_at"`
+	// InvitedAt set for accounts pre-provisioned by an admin import
+	InvitedAt *time.Time `json:"invited_at"`
+	// TokensRevokedAt tokens issued before this instant are rejected
+	TokensRevokedAt *time.Time `json:"-"`
 }
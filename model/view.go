@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// ProductView product detail view by an authenticated user
+type ProductView struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ProductID uint      `gorm:"not null;index" json:"product_id"`
+}
@@ -0,0 +1,44 @@
+package random
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+var source = struct {
+	sync.RWMutex
+	r io.Reader
+}{r: rand.Reader}
+
+// SetSource replace the random source behind Bytes and Hex, for deterministic tests;
+// nil restores crypto/rand, which is always used in production
+func SetSource(r io.Reader) {
+	if r == nil {
+		r = rand.Reader
+	}
+	source.Lock()
+	source.r = r
+	source.Unlock()
+}
+
+// Bytes n random bytes from the installed source
+func Bytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	source.RLock()
+	defer source.RUnlock()
+	if _, err := io.ReadFull(source.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Hex n random bytes, hex encoded
+func Hex(n int) (string, error) {
+	b, err := Bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
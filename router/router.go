@@ -1,34 +1,174 @@
 package router
 
 import (
+	"app/config"
 	"app/handler"
 	"app/middleware"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 // SetupRoutes setup router api
 func SetupRoutes(app *fiber.App) {
 	// Middleware
+	app.Use(middleware.Envelope())
+	app.Use(middleware.Recover())
+	app.Use(requestid.New())
+	if config.Config("APP_ENV") == "dev" {
+		app.Use(middleware.QueryCount())
+	}
+	if config.Config("METRICS_ENABLED") == "true" {
+		app.Use(expvar.New())
+	}
+	app.Use(middleware.RateLimitWarning())
+	app.Use(middleware.CrawlerLimiter())
+	app.Use(middleware.ReadOnly())
+	if middleware.CookieAuth() {
+		app.Use(middleware.CSRF())
+	}
+	if middleware.ChaosEnabled() {
+		app.Use(middleware.Chaos())
+	}
 	api := app.Group("/api", logger.New())
 	api.Get("/", handler.Hello)
 
-	// Auth
-	auth := api.Group("/auth")
-	auth.Post("/login", handler.Login)
+	SetupAuthRoutes(api)
 
 	// User
 	user := api.Group("/user")
+	user.Get("/me", middleware.Protected(), middleware.LoadUser(), handler.GetCurrentUser)
+	user.Get("/me/recently-viewed", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeProductsRead), handler.GetRecentlyViewed)
+	user.Get("/me/ip-allowlist", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), handler.GetMyIPAllowlist)
+	user.Post("/me/ip-allowlist", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), handler.AddMyIPAllowlistEntry)
+	user.Delete("/me/ip-allowlist/:entryId", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), handler.DeleteMyIPAllowlistEntry)
+	user.Get("/me/security/report", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), handler.GetSecurityReport)
+	user.Put("/me/phone", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), handler.SetMyPhone)
+	user.Post("/me/phone/verify", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), handler.VerifyMyPhone)
+	user.Get("/me/identities", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), handler.GetMyIdentities)
+	user.Delete("/me/identities/:identityId", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), middleware.RequireFreshAuth(), handler.UnlinkMyIdentity)
+	user.Patch("/me/email", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), middleware.RequireFreshAuth(), handler.ChangeMyEmail)
+	user.Delete("/me/email", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), handler.CancelMyEmailChange)
+	user.Get("/email/confirm", handler.ConfirmEmailChange)
 	user.Get("/:id", handler.GetUser)
-	user.Post("/", handler.CreateUser)
-	user.Patch("/:id", middleware.Protected(), handler.UpdateUser)
-	user.Delete("/:id", middleware.Protected(), handler.DeleteUser)
+	user.Post("/", middleware.OptionalAuth(), handler.CreateUser)
+	user.Patch("/:id", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeUsersWrite), handler.UpdateUser)
+	user.Delete("/:id", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), middleware.RequireFreshAuth(), handler.DeleteUser)
+	user.Post("/:id/anonymize", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), middleware.RequireFreshAuth(), handler.AnonymizeUser)
 
 	// Product
 	product := api.Group("/product")
-	product.Get("/", handler.GetAllProducts)
-	product.Get("/:id", handler.GetProduct)
-	product.Post("/", middleware.Protected(), handler.CreateProduct)
-	product.Delete("/:id", middleware.Protected(), handler.DeleteProduct)
+	product.Get("/", middleware.ResponseCache(handler.ProductListTags), handler.GetAllProducts)
+	product.Get("/suggest", middleware.SuggestLimiter(), handler.SuggestProducts)
+	product.Get("/trending", handler.GetTrendingProducts)
+	product.Get("/:id", middleware.ResponseCache(handler.ProductTags), handler.GetProduct)
+	product.Post("/", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeProductsWrite), handler.CreateProduct)
+	product.Post("/:id/view", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeProductsRead), handler.ViewProduct)
+	product.Get("/:id/translations", handler.GetProductTranslations)
+	product.Put("/:id/translations/:locale", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeProductsWrite), handler.PutProductTranslation)
+	product.Delete("/:id/translations/:locale", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeProductsWrite), handler.DeleteProductTranslation)
+	product.Delete("/:id", middleware.Protected(), middleware.LoadUser(), middleware.RequireScope(middleware.ScopeProductsWrite), handler.DeleteProduct)
+
+	// Categories
+	category := api.Group("/categories")
+	category.Get("/", handler.GetCategoryTree)
+	category.Get("/:id", handler.GetCategory)
+	category.Get("/:id/attributes", handler.GetCategoryAttributes)
+
+	// Jobs
+	job := api.Group("/jobs", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken())
+	job.Get("/:id", handler.GetJob)
+	job.Get("/:id/result", handler.GetJobResult)
+
+	// Uploads
+	upload := api.Group("/uploads", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken())
+	upload.Post("/", handler.CreateUpload)
+	upload.Get("/:id", handler.GetUpload)
+	upload.Put("/:id/parts/:number", handler.PutUploadPart)
+	upload.Post("/:id/complete", handler.CompleteUpload)
+	upload.Delete("/:id", handler.AbortUpload)
+
+	// Analytics
+	api.Post("/analytics/events", middleware.Protected(), middleware.LoadUser(), handler.CollectAnalyticsEvents)
+
+	// Experiments
+	experiment := api.Group("/experiments", middleware.Protected(), middleware.LoadUser())
+	experiment.Get("/assignments", handler.GetExperimentAssignments)
+	experiment.Post("/:key/exposures", handler.LogExperimentExposure)
+
+	SetupAdminRoutes(api)
+
+	// Feeds
+	app.Get("/robots.txt", handler.Robots)
+	app.Get("/sitemap.xml", handler.Sitemap)
+	app.Get("/feed.xml", handler.Feed)
+
+	// Frontend
+	if dir := config.Config("STATIC_DIR"); dir != "" {
+		if err := handler.LoadAssetManifest(dir); err != nil {
+			log.Println("failed to build asset manifest:", err)
+		}
+		api.Get("/assets/manifest", handler.AssetManifest)
+		app.Static("/", dir, fiber.Static{
+			Compress:       true,
+			ModifyResponse: handler.AssetCacheHeaders,
+		})
+		app.Use(handler.SPAFallback(dir))
+	}
+}
+
+// SetupAuthRoutes setup auth routes sharing one rate limiter
+func SetupAuthRoutes(api fiber.Router) {
+	limit := middleware.AuthLimiter()
+
+	auth := api.Group("/auth")
+	captcha := middleware.Captcha()
+	auth.Post("/login", limit, captcha, middleware.ReplayProtection(), middleware.LegacyFields("login", map[string]string{"identity": "email_or_username"}), handler.Login)
+	auth.Post("/register", limit, captcha, middleware.OptionalAuth(), handler.Register)
+	auth.Post("/guest", limit, captcha, handler.CreateGuest)
+	auth.Post("/otp/request", limit, captcha, handler.RequestLoginOTP)
+	auth.Post("/otp/verify", limit, handler.VerifyLoginOTP)
+	auth.Post("/logout", middleware.Protected(), middleware.LoadUser(), handler.Logout)
+	auth.Post("/logout-all", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), handler.LogoutAll)
+	auth.Post("/token", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.NotImpersonated(), middleware.RequireFreshAuth(), handler.IssueScopedToken)
+}
+
+// SetupAdminRoutes setup routes restricted to admins
+func SetupAdminRoutes(api fiber.Router) {
+	admin := api.Group("/admin", middleware.Protected(), middleware.LoadUser(), middleware.RequireFullToken(), middleware.AdminOnly())
+	admin.Get("/events", handler.GetEvents)
+	admin.Get("/audit-logs", handler.GetAuditLogs)
+	admin.Get("/read-only", handler.GetReadOnly)
+	admin.Put("/read-only", handler.SetReadOnly)
+	admin.Post("/categories", handler.CreateCategory)
+	admin.Patch("/categories/:id", handler.RenameCategory)
+	admin.Post("/categories/:id/move", handler.MoveCategory)
+	admin.Delete("/categories/:id", handler.DeleteCategory)
+	admin.Post("/categories/:id/attributes", handler.CreateCategoryAttribute)
+	admin.Delete("/categories/:id/attributes/:attributeId", handler.DeleteCategoryAttribute)
+	admin.Post("/products/moderation/preview", handler.PreviewProductModeration)
+	admin.Post("/products/moderation", handler.ModerateProducts)
+	admin.Get("/experiments", handler.GetExperiments)
+	admin.Post("/experiments", handler.CreateExperiment)
+	admin.Patch("/experiments/:id", handler.UpdateExperiment)
+	if middleware.ChaosEnabled() {
+		admin.Get("/chaos", handler.GetChaos)
+		admin.Put("/chaos", handler.SetChaos)
+	}
+
+	// User management
+	admin.Get("/users", handler.AdminGetUsers)
+	admin.Post("/users/import", handler.AdminImportUsers)
+	admin.Post("/users/:id/suspend", handler.AdminSuspendUser)
+	admin.Post("/users/:id/unsuspend", handler.AdminUnsuspendUser)
+	admin.Post("/users/:id/logout", handler.AdminLogoutUser)
+	admin.Post("/users/:id/anonymize", handler.AdminAnonymizeUser)
+	admin.Post("/users/:id/restore", handler.AdminRestoreUser)
+	admin.Post("/users/:id/impersonate", handler.AdminImpersonateUser)
+	admin.Get("/users/:id/ip-allowlist", handler.AdminGetIPAllowlist)
+	admin.Post("/users/:id/ip-allowlist", handler.AdminAddIPAllowlistEntry)
+	admin.Delete("/users/:id/ip-allowlist/:entryId", handler.AdminDeleteIPAllowlistEntry)
 }
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"app/config"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrDisabled returned when SCANNER=none, files are then accepted unscanned
+var ErrDisabled = errors.New("malware scanning is disabled")
+
+// Result verdict on one file
+type Result struct {
+	Infected bool
+	// Signature name of the detected malware
+	Signature string
+}
+
+// Scanner checks file contents for malware
+type Scanner interface {
+	Scan(ctx context.Context, data []byte) (Result, error)
+}
+
+// New scanner chosen by SCANNER: clamav (the default) talks to the clamd at CLAMAV_ADDR,
+// none turns scanning off.
+func New() Scanner {
+	if config.Config("SCANNER") == "none" {
+		return disabled{}
+	}
+	addr := config.Config("CLAMAV_ADDR")
+	if addr == "" {
+		addr = "clamav:3310"
+	}
+	return &ClamAV{Addr: addr, Timeout: time.Minute}
+}
+
+type disabled struct{}
+
+func (disabled) Scan(context.Context, []byte) (Result, error) { return Result{}, ErrDisabled }
+
+// clamChunkSize bytes per INSTREAM chunk, well under clamd's default StreamMaxLength
+const clamChunkSize = 64 << 10
+
+// ClamAV scanner backed by a clamd daemon's INSTREAM command
+type ClamAV struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// Scan stream data to clamd and parse its one-line verdict
+func (s *ClamAV) Scan(ctx context.Context, data []byte) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	size := make([]byte, 4)
+	for len(data) > 0 {
+		n := len(data)
+		if n > clamChunkSize {
+			n = clamChunkSize
+		}
+		binary.BigEndian.PutUint32(size, uint32(n))
+		w.Write(size)
+		w.Write(data[:n])
+		data = data[n:]
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	w.Write(size)
+	if err := w.Flush(); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	line := string(bytes.TrimRight(reply, "\x00"))
+	line = strings.TrimPrefix(line, "stream: ")
+	switch {
+	case line == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(line, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(line, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamd: %s", line)
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"app/database"
+	"context"
+	"log"
+	"time"
+)
+
+// Job unit of background work run by the scheduler
+type Job func(ctx context.Context) error
+
+// claim record that name starts now unless a run started less than interval ago. Ticks on other
+// processes aren't aligned with ours, so a run a few percent early still counts as due.
+func claim(ctx context.Context, name string, interval time.Duration) (bool, error) {
+	due := interval - interval/20
+	res := database.DB.WithContext(ctx).Exec(
+		`INSERT INTO scheduled_runs (name, last_run_at) VALUES (?, now())
+		 ON CONFLICT (name) DO UPDATE SET last_run_at = now()
+		 WHERE scheduled_runs.last_run_at <= now() - make_interval(secs => ?)`,
+		name, due.Seconds())
+	return res.RowsAffected > 0, res.Error
+}
+
+func run(name string, interval time.Duration, job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	ran := false
+	_, err := database.WithAdvisoryLock(ctx, "job:"+name, func(ctx context.Context) error {
+		due, err := claim(ctx, name, interval)
+		if err != nil || !due {
+			return err
+		}
+		ran = true
+		return job(ctx)
+	})
+	if err != nil {
+		log.Printf("job %q failed: %v", name, err)
+	} else if ran {
+		log.Printf("job %q done", name)
+	}
+}
+
+// Every run job about once each interval across the fleet. Every process ticks, but the
+// Postgres advisory lock named after the job keeps runs from overlapping, and the run's
+// start time, shared through scheduled_runs, makes ticks within interval of it skip.
+func Every(name string, interval time.Duration, job Job) {
+	go func() {
+		run(name, interval, job)
+		for range time.Tick(interval) {
+			run(name, interval, job)
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package sms
+
+import (
+	"app/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrDisabled returned by the disabled sender when SMS_PROVIDER is unset
+var ErrDisabled = errors.New("SMS is not configured")
+
+// Sender delivers text messages to E.164 phone numbers
+type Sender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// New sender chosen by SMS_PROVIDER: twilio, or log to print messages during development.
+// Unset, every send fails with ErrDisabled.
+func New() Sender {
+	switch config.Config("SMS_PROVIDER") {
+	case "twilio":
+		return &Twilio{
+			AccountSID: config.Config("TWILIO_ACCOUNT_SID"),
+			AuthToken:  config.Config("TWILIO_AUTH_TOKEN"),
+			From:       config.Config("TWILIO_FROM"),
+			Client:     &http.Client{Timeout: 10 * time.Second},
+		}
+	case "log":
+		return logSender{}
+	}
+	return disabled{}
+}
+
+type disabled struct{}
+
+func (disabled) Send(context.Context, string, string) error { return ErrDisabled }
+
+type logSender struct{}
+
+func (logSender) Send(_ context.Context, to, body string) error {
+	log.Printf("sms to %s: %s", to, body)
+	return nil
+}
+
+// Twilio sends through the Twilio Messages API
+type Twilio struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+	Client     *http.Client
+}
+
+// Send implements Sender
+func (t *Twilio) Send(ctx context.Context, to, body string) error {
+	endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + url.PathEscape(t.AccountSID) + "/Messages.json"
+	form := url.Values{"To": {to}, "From": {t.From}, "Body": {body}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("twilio returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package startup
+
+import (
+	"app/config"
+	"app/database"
+	"app/handler"
+	"app/idgen"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// StepError failure of a single startup step
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("startup step %q failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+type step struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+var steps = []step{
+	{"connect database", database.Connect},
+	{"migrate database", database.Migrate},
+	{"verify database", database.Ping},
+	{"claim ID worker", claimWorker},
+	{"configure password hashing", configureHashing},
+	{"warm feeds", func(context.Context) error { return handler.RefreshFeeds() }},
+}
+
+// claimWorker set the idgen worker from WORKER_ID (0-31, one per host) and a
+// process slot claimed in the database, since prefork runs several processes per host
+func claimWorker(ctx context.Context) error {
+	node := 0
+	if v := config.Config("WORKER_ID"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 31 {
+			return fmt.Errorf("WORKER_ID must be 0-31, got %q", v)
+		}
+		node = n
+	}
+	slot, err := database.ClaimSlot(ctx, fmt.Sprintf("idgen:%d", node), 32)
+	if err != nil {
+		return err
+	}
+	return idgen.SetWorker(int64(node<<5 | slot))
+}
+
+// configureHashing apply BCRYPT_COST (default 14, at least 10) to new password hashes.
+// Hashes made at a lower cost are upgraded on the user's next login.
+func configureHashing(context.Context) error {
+	v := config.Config("BCRYPT_COST")
+	if v == "" {
+		return nil
+	}
+	cost, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("BCRYPT_COST must be a number, got %q", v)
+	}
+	return handler.SetBcryptCost(cost)
+}
+
+// Run prepare every dependency before the server listens, within STARTUP_TIMEOUT (default 30s)
+func Run() error {
+	timeout, err := time.ParseDuration(config.Config("STARTUP_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, s := range steps {
+		start := time.Now()
+		if err := s.run(ctx); err != nil {
+			return &StepError{Step: s.name, Err: err}
+		}
+		log.Printf("startup step %q done in %s", s.name, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"app/config"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const hibpRangeURL = "https://api.pwnedpasswords.com/range/"
+
+var hibpClient = &http.Client{Timeout: 3 * time.Second}
+
+// pwnedPassword report whether password appears in the Have I Been Pwned corpus.
+// Only the first five hex characters of its SHA-1 leave the process.
+func pwnedPassword(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequest(http.MethodGet, hibpRangeURL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// padded responses hide the real number of matches from observers
+	req.Header.Set("Add-Padding", "true")
+	resp, err := hibpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HIBP range API returned %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if line == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// notBreachedPassword reject passwords found in known breaches when PASSWORD_BREACH_CHECK=true.
+// The check fails open: if the API cannot be reached the password is accepted.
+func notBreachedPassword(fl validator.FieldLevel) bool {
+	if config.Config("PASSWORD_BREACH_CHECK") != "true" {
+		return true
+	}
+	pwned, err := pwnedPassword(fl.Field().String())
+	if err != nil {
+		log.Println("failed to check password against HIBP:", err)
+		return true
+	}
+	return !pwned
+}
@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+)
+
+var disposableDomains = map[string]bool{
+	"10minutemail.com":    true,
+	"dispostable.com":     true,
+	"getnada.com":         true,
+	"guerrillamail.com":   true,
+	"mailinator.com":      true,
+	"maildrop.cc":         true,
+	"sharklasers.com":     true,
+	"temp-mail.org":       true,
+	"tempmail.com":        true,
+	"throwawaymail.com":   true,
+	"trashmail.com":       true,
+	"yopmail.com":         true,
+	"fakeinbox.com":       true,
+	"mailnesia.com":       true,
+	"mintemail.com":       true,
+	"spamgourmet.com":     true,
+	"emailondeck.com":     true,
+	"moakt.com":           true,
+	"burnermail.io":       true,
+	"tempmailaddress.com": true,
+}
+
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "api": true, "me": true,
+	"root": true, "support": true, "system": true,
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// notDisposableEmail reject addresses on known throwaway mail domains
+func notDisposableEmail(fl validator.FieldLevel) bool {
+	_, domain, ok := strings.Cut(fl.Field().String(), "@")
+	if !ok {
+		return true
+	}
+	return !disposableDomains[strings.ToLower(domain)]
+}
+
+// strongPassword require 8+ characters mixing upper case, lower case and digits
+func strongPassword(fl validator.FieldLevel) bool {
+	p := fl.Field().String()
+	if len([]rune(p)) < 8 {
+		return false
+	}
+	var upper, lower, digit bool
+	for _, r := range p {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// safeUsername allow letters, digits, dot, dash and underscore, excluding reserved names
+func safeUsername(fl validator.FieldLevel) bool {
+	u := fl.Field().String()
+	return usernamePattern.MatchString(u) && !reservedUsernames[strings.ToLower(u)]
+}
+
+// customMessages translation per locale of each custom rule, {0} is the field name
+var customMessages = map[string]map[string]string{
+	"not_disposable_email": {
+		"en": "{0} must not use a disposable email provider",
+		"es": "{0} no debe usar un proveedor de correo desechable",
+		"fr": "{0} ne doit pas utiliser un fournisseur d'e-mail jetable",
+		"pt": "{0} não deve usar um provedor de e-mail descartável",
+	},
+	"strong_password": {
+		"en": "{0} must have at least 8 characters with upper case, lower case and digits",
+		"es": "{0} debe tener al menos 8 caracteres con mayúsculas, minúsculas y dígitos",
+		"fr": "{0} doit contenir au moins 8 caractères avec majuscules, minuscules et chiffres",
+		"pt": "{0} deve ter pelo menos 8 caracteres com maiúsculas, minúsculas e dígitos",
+	},
+	"not_breached_password": {
+		"en": "{0} has appeared in a data breach, choose a different one",
+		"es": "{0} ha aparecido en una filtración de datos, elige otra",
+		"fr": "{0} est apparu dans une fuite de données, choisissez-en un autre",
+		"pt": "{0} apareceu em um vazamento de dados, escolha outra",
+	},
+	"e164_phone": {
+		"en": "{0} must be a phone number in E.164 format",
+		"es": "{0} debe ser un número de teléfono en formato E.164",
+		"fr": "{0} doit être un numéro de téléphone au format E.164",
+		"pt": "{0} deve ser um número de telefone no formato E.164",
+	},
+	"safe_username": {
+		"en": "{0} may only contain letters, digits, '.', '-' and '_' and must not be a reserved name",
+		"es": "{0} solo puede contener letras, dígitos, '.', '-' y '_' y no debe ser un nombre reservado",
+		"fr": "{0} ne peut contenir que des lettres, chiffres, '.', '-' et '_' et ne doit pas être un nom réservé",
+		"pt": "{0} só pode conter letras, dígitos, '.', '-' e '_' e não deve ser um nome reservado",
+	},
+}
+
+// registerRules add the custom rules to v. iso4217 is provided by the validator itself.
+func registerRules(v *validator.Validate) error {
+	rules := map[string]validator.Func{
+		"not_disposable_email":  notDisposableEmail,
+		"strong_password":       strongPassword,
+		"not_breached_password": notBreachedPassword,
+		"safe_username":         safeUsername,
+	}
+	for tag, fn := range rules {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			return err
+		}
+	}
+	v.RegisterAlias("e164_phone", "e164")
+	return nil
+}
+
+// registerRuleMessages add the custom rule messages for the given translator
+func registerRuleMessages(v *validator.Validate, trans ut.Translator) error {
+	for tag, messages := range customMessages {
+		msg, ok := messages[trans.Locale()]
+		if !ok {
+			msg = messages["en"]
+		}
+		tag, msg := tag, msg
+		err := v.RegisterTranslation(tag, trans,
+			func(ut ut.Translator) error {
+				return ut.Add(tag, msg, true)
+			},
+			func(ut ut.Translator, fe validator.FieldError) string {
+				t, _ := ut.T(tag, fe.Field())
+				return t
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
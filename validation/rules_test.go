@@ -0,0 +1,36 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+type fuzzSignup struct {
+	Email    string `json:"email" validate:"required,email,not_disposable_email"`
+	Username string `json:"username" validate:"required,safe_username"`
+	Password string `json:"password" validate:"required,strong_password"`
+}
+
+func FuzzRules(f *testing.F) {
+	f.Add("jane@example.com", "jane.doe", "Secret123", "en")
+	f.Add("jane@MAILINATOR.com", "admin", "short", "es")
+	f.Add("not-an-email", ".dot", "ÀÉÎõü123", "fr")
+	f.Add("@", "", "\x00\x00\x00\x00\x00\x00\x00\x00", "pt")
+	f.Add("a@b@c", "ROOT", "Ǆǅǆ12345", "xx")
+	f.Fuzz(func(t *testing.T, email, username, password, locale string) {
+		errs := Struct(fuzzSignup{Email: email, Username: username, Password: password}, locale)
+		for field, msg := range errs {
+			switch field {
+			case "email", "username", "password":
+			default:
+				t.Fatalf("unexpected field %q in %v", field, errs)
+			}
+			if msg == "" {
+				t.Fatalf("empty message for %q", field)
+			}
+		}
+		if _, bad := errs["username"]; !bad && (reservedUsernames[strings.ToLower(username)] || !usernamePattern.MatchString(username)) {
+			t.Fatalf("username %q accepted", username)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// clean drop control and invisible format characters (zero-width spaces, bidi overrides,
+// BOMs) from s, keeping newlines and tabs when multiline, then NFC-normalize it; dropping
+// first lets combining marks the dropped characters separated compose. The result is
+// trimmed and cut to at most max runes, never mid-character; max 0 means no limit.
+func clean(s string, max int, multiline bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if multiline && (r == '\n' || r == '\t') {
+			b.WriteRune(r)
+			continue
+		}
+		if r == unicode.ReplacementChar || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	s = strings.TrimSpace(norm.NFC.String(b.String()))
+
+	if max > 0 {
+		if runes := []rune(s); len(runes) > max {
+			s = strings.TrimSpace(string(runes[:max]))
+		}
+	}
+	return s
+}
+
+// CleanLine sanitize single-line text such as names, usernames and titles
+func CleanLine(s string, max int) string {
+	return clean(s, max, false)
+}
+
+// CleanText sanitize multi-line text such as descriptions
+func CleanText(s string, max int) string {
+	return clean(s, max, true)
+}
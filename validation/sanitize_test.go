@@ -0,0 +1,41 @@
+package validation
+
+import (
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func FuzzClean(f *testing.F) {
+	f.Add("Jane Doe", 10, false)
+	f.Add("  padded\t", 0, false)
+	f.Add("line one\nline two\ttabbed", 12, true)
+	f.Add("zero\u200bwidth\u202ebidi\ufeff", 5, false)
+	f.Add("ééé", 2, false)
+	f.Add("日本語テキスト", 3, true)
+	f.Add("\xff\xfeinvalid", 4, false)
+	f.Fuzz(func(t *testing.T, s string, max int, multiline bool) {
+		if max < 0 {
+			max = -max
+		}
+		max %= 256
+		out := clean(s, max, multiline)
+		if !utf8.ValidString(out) {
+			t.Fatalf("clean(%q) = %q, not valid UTF-8", s, out)
+		}
+		if max > 0 && utf8.RuneCountInString(out) > max {
+			t.Fatalf("clean(%q, %d) = %q, longer than the limit", s, max, out)
+		}
+		for _, r := range out {
+			if multiline && (r == '\n' || r == '\t') {
+				continue
+			}
+			if r == unicode.ReplacementChar || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+				t.Fatalf("clean(%q) = %q, kept %U", s, out, r)
+			}
+		}
+		if again := clean(out, max, multiline); again != out {
+			t.Fatalf("clean is not idempotent: %q then %q", out, again)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	"github.com/go-playground/locales/pt"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+	pt_translations "github.com/go-playground/validator/v10/translations/pt"
+)
+
+// Locales supported for validation messages, the first one is the fallback
+var Locales = []string{"en", "es", "fr", "pt"}
+
+var (
+	validate *validator.Validate
+	uni      *ut.UniversalTranslator
+)
+
+func init() {
+	validate = validator.New()
+	// report fields by their JSON name
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	if err := registerRules(validate); err != nil {
+		panic("failed to register validation rules: " + err.Error())
+	}
+
+	fallback := en.New()
+	uni = ut.New(fallback, fallback, es.New(), fr.New(), pt.New())
+
+	register := map[locales.Translator]func(*validator.Validate, ut.Translator) error{
+		fallback: en_translations.RegisterDefaultTranslations,
+		es.New(): es_translations.RegisterDefaultTranslations,
+		fr.New(): fr_translations.RegisterDefaultTranslations,
+		pt.New(): pt_translations.RegisterDefaultTranslations,
+	}
+	for l, fn := range register {
+		trans, _ := uni.GetTranslator(l.Locale())
+		if err := fn(validate, trans); err != nil {
+			panic("failed to register " + l.Locale() + " validation messages: " + err.Error())
+		}
+		if err := registerRuleMessages(validate, trans); err != nil {
+			panic("failed to register " + l.Locale() + " validation messages: " + err.Error())
+		}
+	}
+}
+
+// Struct validate s and return a message per invalid field in the given locale.
+// Unknown locales fall back to English; nil means s is valid.
+func Struct(s interface{}, locale string) map[string]string {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return map[string]string{"": err.Error()}
+	}
+
+	trans, _ := uni.GetTranslator(locale)
+	messages := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		messages[fe.Field()] = fe.Translate(trans)
+	}
+	return messages
+}